@@ -0,0 +1,25 @@
+package ripper
+
+import "github.com/zachfi/streamgo/pkg/adts"
+
+// adtsSyncFrames is how many consecutive frames must chain for a frame
+// sync to be believed.
+const adtsSyncFrames = 2
+
+// findADTSFrameSync returns the offset of the first ADTS frame that starts
+// a chain of adtsSyncFrames frames, or -1 if not found.
+func findADTSFrameSync(b []byte) int {
+	return adts.FindSync(b, adtsSyncFrames)
+}
+
+// adtsFrame implements codec.frame for ADTS.
+func adtsFrame(b []byte) (n, samples, rate int) {
+	if len(b) < adts.HeaderLen {
+		return -1, 0, 0
+	}
+	h, ok := adts.ParseHeader(b)
+	if !ok {
+		return 0, 0, 0
+	}
+	return h.FrameLen, h.Samples(), h.SampleRate
+}
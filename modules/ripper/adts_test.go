@@ -0,0 +1,16 @@
+package ripper
+
+import "testing"
+
+func TestADTSFrame(t *testing.T) {
+	b := []byte{0xFF, 0xF8, 0x4C, 0x40, 0x20, 0x1F, 0xFD}
+	if n, samples, rate := adtsFrame(b); n != 256 || samples != 2048 || rate != 48000 {
+		t.Errorf("adtsFrame() = %d, %d, %d, want 256, 2048, 48000", n, samples, rate)
+	}
+	if n, _, _ := adtsFrame(b[:6]); n != -1 {
+		t.Errorf("adtsFrame() of a short header = %d, want -1", n)
+	}
+	if n, _, _ := adtsFrame([]byte{0, 1, 2, 3, 4, 5, 6}); n != 0 {
+		t.Errorf("adtsFrame() of garbage = %d, want 0", n)
+	}
+}
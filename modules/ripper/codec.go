@@ -0,0 +1,233 @@
+package ripper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mime"
+	"strings"
+)
+
+// sniffLimit is how much audio is searched for a frame or page boundary
+// before a file is started without one.
+const sniffLimit = 8192
+
+// codec describes how recordings of one audio format are stored.
+type codec struct {
+	name string
+	ext  string
+
+	// id3 says whether an ID3v2 tag is put in front of the audio. Players
+	// accept that for MPEG audio and ADTS, but not for Ogg or FLAC, whose
+	// tags live inside the stream. ADTS has no tag format of its own; a
+	// leading ID3v2 tag is the convention for .aac files, which players
+	// built on ffmpeg or VLC read and skip before looking for frames.
+	id3 bool
+
+	// magic identifies the format when there is no content type to go by.
+	// Formats without one are recognised by their frame sync instead.
+	magic []byte
+
+	// sync returns the offset of the first frame or page in b, or -1.
+	sync func(b []byte) int
+
+	// frame parses the frame header at the start of b and returns the
+	// frame's length and how many samples it holds at what sample rate. n is
+	// 0 if b doesn't start with a frame and -1 if b is too short to tell.
+	// Codecs with a frame func are written in whole frames only. FLAC
+	// frame headers don't give a length, so FLAC has none.
+	frame func(b []byte) (n, samples, rate int)
+
+	// streamHeader returns the length of the headers at the start of b that
+	// a decoder needs before any audio (Ogg header pages, FLAC metadata), 0
+	// if b doesn't start with them, or -1 if more data is needed to tell.
+	// It is nil for formats where every frame stands alone.
+	streamHeader func(b []byte) int
+}
+
+var (
+	oggMagic  = []byte("OggS")
+	flacMagic = []byte("fLaC")
+)
+
+var (
+	codecMP3 = &codec{name: "mp3", ext: ".mp3", id3: true, sync: findMP3FrameSync, frame: mp3Frame}
+	codecAAC = &codec{name: "aac", ext: ".aac", id3: true, sync: findADTSFrameSync, frame: adtsFrame}
+	codecOgg = &codec{
+		name: "ogg", ext: ".ogg",
+		magic: oggMagic, sync: findOggPage, frame: oggFrame, streamHeader: oggHeaderLen,
+	}
+	codecFLAC = &codec{
+		name: "flac", ext: ".flac",
+		magic: flacMagic, sync: findFLACSync, streamHeader: flacHeaderLen,
+	}
+)
+
+// sniffOrder is the order formats are tried in when the content type is
+// unknown or wrong. Formats with a magic string come first, as frame syncs
+// are easy to find by accident.
+var sniffOrder = []*codec{codecOgg, codecFLAC, codecMP3, codecAAC}
+
+// codecForContentType returns the codec a Content-Type announces, or nil.
+func codecForContentType(contentType string) *codec {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	switch mt {
+	case "audio/mpeg", "audio/mp3", "audio/mpeg3", "audio/x-mpeg":
+		return codecMP3
+	case "audio/aac", "audio/aacp", "audio/x-aac", "audio/x-aacp", "audio/adts":
+		return codecAAC
+	case "application/ogg", "audio/ogg", "audio/vorbis", "audio/opus", "audio/x-ogg":
+		return codecOgg
+	case "audio/flac", "audio/x-flac":
+		return codecFLAC
+	}
+	return nil
+}
+
+// detectCodec identifies the format of b and returns it with the offset of
+// the first frame or page. The content type is trusted when b agrees with
+// it. Otherwise b is sniffed, but only once more than sniffLimit bytes have
+// failed to match the content type: a frame chain may simply not fit in a
+// short read yet, and the weaker syncs of other formats are easily matched
+// by audio payload. It returns nil if b doesn't contain enough to tell.
+func detectCodec(contentType string, b []byte) (*codec, int) {
+	hint := codecForContentType(contentType)
+	if hint != nil {
+		if pos := hint.sync(b); pos >= 0 {
+			return hint, pos
+		}
+		if len(b) <= sniffLimit {
+			return nil, -1
+		}
+	}
+
+	for _, c := range sniffOrder {
+		if c == hint {
+			continue
+		}
+		var pos int
+		if c.magic != nil {
+			pos = bytes.Index(b, c.magic)
+		} else {
+			pos = c.sync(b)
+		}
+		if pos >= 0 {
+			return c, pos
+		}
+	}
+	return nil, -1
+}
+
+// findOggPage returns the offset of the first Ogg page.
+func findOggPage(b []byte) int {
+	for off := 0; ; off++ {
+		i := bytes.Index(b[off:], oggMagic)
+		if i < 0 || off+i+4 >= len(b) {
+			return -1
+		}
+		off += i
+		if b[off+4] == 0 { // stream structure version
+			return off
+		}
+	}
+}
+
+// oggPageLen returns the length of the Ogg page at the start of b and its
+// granule position, or -1 if b doesn't hold the whole page.
+func oggPageLen(b []byte) (int, int64) {
+	if len(b) < 27 {
+		return -1, 0
+	}
+	segments := int(b[26])
+	if len(b) < 27+segments {
+		return -1, 0
+	}
+	n := 27 + segments
+	for _, s := range b[27 : 27+segments] {
+		n += int(s)
+	}
+	if len(b) < n {
+		return -1, 0
+	}
+	return n, int64(binary.LittleEndian.Uint64(b[6:14]))
+}
+
+// oggFrame implements codec.frame for Ogg, with pages as frames. The
+// samples in a page aren't counted.
+func oggFrame(b []byte) (n, samples, rate int) {
+	if len(b) < 5 {
+		return -1, 0, 0
+	}
+	if !bytes.HasPrefix(b, oggMagic) || b[4] != 0 {
+		return 0, 0, 0
+	}
+	n, _ = oggPageLen(b)
+	return n, 0, 0
+}
+
+// oggHeaderLen returns the length of the header pages when b starts a
+// logical stream: the beginning-of-stream page and the pages after it up to
+// the first one with audio, i.e. a granule position other than 0.
+func oggHeaderLen(b []byte) int {
+	if len(b) < 6 || !bytes.HasPrefix(b, oggMagic) || b[5]&0x02 == 0 {
+		return 0
+	}
+	off := 0
+	for {
+		n, granule := oggPageLen(b[off:])
+		if n < 0 {
+			return -1
+		}
+		if granule != 0 && off > 0 {
+			return off
+		}
+		off += n
+	}
+}
+
+// findFLACSync returns the offset of the "fLaC" stream marker or, failing
+// that, of the first frame sync code.
+func findFLACSync(b []byte) int {
+	if i := bytes.Index(b, flacMagic); i >= 0 {
+		return i
+	}
+	for i := 0; i+1 < len(b); i++ {
+		if b[i] == 0xFF && b[i+1]&0xFE == 0xF8 {
+			return i
+		}
+	}
+	return -1
+}
+
+// flacHeaderLen returns the length of the "fLaC" marker and the metadata
+// blocks following it.
+func flacHeaderLen(b []byte) int {
+	if !bytes.HasPrefix(b, flacMagic) {
+		if len(b) < len(flacMagic) && bytes.HasPrefix(flacMagic, b) {
+			return -1
+		}
+		return 0
+	}
+	off := len(flacMagic)
+	for {
+		if len(b) < off+4 {
+			return -1
+		}
+		last := b[off]&0x80 != 0
+		off += 4 + (int(b[off+1])<<16 | int(b[off+2])<<8 | int(b[off+3]))
+		if len(b) < off {
+			return -1
+		}
+		if last {
+			return off
+		}
+	}
+}
+
+// isOpus reports whether Ogg headers belong to an Opus stream, which is
+// stored as .opus rather than .ogg.
+func isOpus(header []byte) bool {
+	return bytes.Contains(header, []byte("OpusHead"))
+}
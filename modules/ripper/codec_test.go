@@ -0,0 +1,94 @@
+package ripper
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"testing"
+)
+
+// mp3Stream returns n frames of MPEG-1 Layer III at 128 kbps and 44.1 kHz
+// with random payload.
+func mp3Stream(r *rand.Rand, n int) []byte {
+	var b bytes.Buffer
+	frame := make([]byte, 417)
+	for range n {
+		for i := range frame {
+			frame[i] = byte(r.Uint32())
+		}
+		copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+		b.Write(frame)
+	}
+	return b.Bytes()
+}
+
+// adtsStream returns n ADTS frames of 371 bytes, AAC LC at 44.1 kHz stereo,
+// with random payload.
+func adtsStream(r *rand.Rand, n int) []byte {
+	const size = 371
+	var b bytes.Buffer
+	frame := make([]byte, size)
+	for range n {
+		for i := range frame {
+			frame[i] = byte(r.Uint32())
+		}
+		copy(frame, []byte{0xFF, 0xF1, 0x50, 0x80 | size>>11, size >> 3 & 0xFF, (size&7)<<5 | 0x1F, 0xFC})
+		b.Write(frame)
+	}
+	return b.Bytes()
+}
+
+// TestDetectCodecShortReads checks that a short read of an MPEG stream, one
+// too short to hold a frame chain, never passes for another format.
+func TestDetectCodecShortReads(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	stream := mp3Stream(r, 200)
+
+	for range 5000 {
+		off := r.IntN(len(stream) - 700)
+		c, pos := detectCodec("audio/mpeg", stream[off:off+700])
+		if c != nil && c != codecMP3 {
+			t.Fatalf("700 bytes at %d detected as %s at %d", off, c.name, pos)
+		}
+	}
+}
+
+func TestDetectCodec(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	mp3 := mp3Stream(r, 40)
+	aac := adtsStream(r, 40)
+	ogg := append([]byte("OggS\x00\x02"), make([]byte, 100)...)
+
+	tests := []struct {
+		name        string
+		contentType string
+		b           []byte
+		want        *codec
+		wantPos     int
+	}{
+		{"mp3", "audio/mpeg", mp3, codecMP3, 0},
+		{"mp3 mid-frame", "audio/mpeg", mp3[100:], codecMP3, 317},
+		{"aac", "audio/aacp", aac, codecAAC, 0},
+		{"ogg", "application/ogg", ogg, codecOgg, 0},
+		{"short mp3", "audio/mpeg", mp3[:600], nil, -1},
+		{"short aac", "audio/aacp", aac[:371+6], nil, -1},
+		{"aac sent as mpeg", "audio/mpeg", aac, codecAAC, 0},
+		{"aac, not enough to sniff", "audio/mpeg", aac[:sniffLimit], nil, -1},
+		{"mp3 without content type", "", mp3, codecMP3, 0},
+		{"ogg without content type", "application/octet-stream", ogg, codecOgg, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, pos := detectCodec(tt.contentType, tt.b)
+			if c != tt.want || pos != tt.wantPos {
+				name := func(c *codec) string {
+					if c == nil {
+						return "nil"
+					}
+					return c.name
+				}
+				t.Errorf("detectCodec() = %s at %d, want %s at %d", name(c), pos, name(tt.want), tt.wantPos)
+			}
+		})
+	}
+}
@@ -2,9 +2,16 @@ package ripper
 
 import (
 	"flag"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/zachfi/zkit/pkg/util"
+
+	"github.com/zachfi/streamgo/pkg/id3"
+	"github.com/zachfi/streamgo/pkg/shoutcast"
 )
 
 // Write buffer sizing guidance (write-buffer-size):
@@ -12,17 +19,112 @@ import (
 // - NFS: larger buffers amortize round-trip cost; 512KiB–1MiB often performs better than 256KiB.
 // - Upper bound: config is clamped to 4MiB to limit memory and avoid huge single writes.
 const (
-	defaultWriteBufferSize   = 256 * 1024   // 256 KiB
-	defaultReconnectInitial  = 5 * time.Second
-	defaultReconnectMax      = 60 * time.Second
+	defaultWriteBufferSize  = 256 * 1024 // 256 KiB
+	defaultReconnectInitial = 5 * time.Second
+	defaultReconnectMax     = 60 * time.Second
+	defaultMaxReconnects    = 10
+	defaultFailedRetry      = 15 * time.Minute
+	defaultSplitInterval    = time.Hour
+	defaultFinalizeWorkers  = 2
+	defaultBufferSize       = 8 * 1024 * 1024 // 8 MiB, several minutes of typical audio
+	defaultBufferPolicy     = string(BufferBlock)
+	defaultMirrorRecheck    = 5 * time.Minute
+	defaultIdleTimeout      = 30 * time.Second
+	defaultMinThroughput    = 0.5
+	defaultThroughputWindow = time.Minute
+	defaultTitleSeparator   = " - "
+	defaultTagVersion       = tagV24
 )
 
 type Config struct {
-	URL                   string        `yaml:"url,omitempty"`
-	Dir                   string        `yaml:"dir,omitempty"`
-	WriteBufferSize       int           `yaml:"write-buffer-size,omitempty"`   // bytes to buffer before writing (reduces write frequency)
-	ReconnectBackoff      time.Duration `yaml:"reconnect-backoff,omitempty"`   // initial delay before reconnecting after disconnect
-	ReconnectBackoffMax   time.Duration `yaml:"reconnect-backoff-max,omitempty"` // cap on reconnect delay (exponential backoff)
+	URL                 string        `yaml:"url,omitempty"`
+	Dir                 string        `yaml:"dir,omitempty"`
+	WriteBufferSize     int           `yaml:"write-buffer-size,omitempty"`     // bytes to buffer before writing (reduces write frequency)
+	ReconnectBackoff    time.Duration `yaml:"reconnect-backoff,omitempty"`     // initial delay before reconnecting after disconnect
+	ReconnectBackoffMax time.Duration `yaml:"reconnect-backoff-max,omitempty"` // cap on reconnect delay (exponential backoff)
+	MaxReconnects       int           `yaml:"max-reconnects,omitempty"`        // consecutive failed connects before a station is marked failed
+	MaxPermanentErrors  int           `yaml:"max-permanent-errors,omitempty"`  // consecutive permanent errors (404, not a stream) before a station is marked failed; 0 disables
+	FailedRetryInterval time.Duration `yaml:"failed-retry-interval,omitempty"` // delay before restarting a failed station
+	SplitInterval       time.Duration `yaml:"split-interval,omitempty"`        // recording length for streams without metadata
+	FinalizeWorkers     int           `yaml:"finalize-workers,omitempty"`      // concurrent track commits across all stations
+	BufferSize          int           `yaml:"buffer-size,omitempty"`           // audio bytes held in memory per station
+	BufferPolicy        string        `yaml:"buffer-policy,omitempty"`         // block, drop-oldest or spill when the buffer is full
+	BufferSpillDir      string        `yaml:"buffer-spill-dir,omitempty"`      // directory for spill files
+
+	// MirrorRecheckInterval is how often a station recording from a fallback
+	// mirror checks whether a preferred one has recovered.
+	MirrorRecheckInterval time.Duration `yaml:"mirror-recheck-interval,omitempty"`
+
+	// A connection is dropped and reconnected when no audio arrives for
+	// IdleTimeout, or when less than MinThroughput times the advertised
+	// icy-br arrives over ThroughputWindow.
+	IdleTimeout      time.Duration `yaml:"idle-timeout,omitempty"`
+	MinThroughput    float64       `yaml:"min-throughput,omitempty"`
+	ThroughputWindow time.Duration `yaml:"throughput-window,omitempty"`
+
+	// ID3 tags of MP3 and AAC recordings. TitleSeparator splits stream
+	// titles into artist and title, TagFrames picks the frames written (see
+	// tagFrames) and TagText adds fixed text frames such as TPUB. Station
+	// TagText entries are added to these. TagVersion is v2.4, v2.3 or
+	// v2.3+v1 for an ID3v1.1 trailer as well.
+	TitleSeparator string            `yaml:"title-separator,omitempty"`
+	TagFrames      []string          `yaml:"tag-frames,omitempty"`
+	TagText        map[string]string `yaml:"tag-text,omitempty"`
+	TagVersion     string            `yaml:"tag-version,omitempty"`
+
+	// Stations lists the streams to record. When empty, URL and Dir above
+	// describe a single station. The top-level settings are used as defaults
+	// for any station that does not override them.
+	Stations []StationConfig `yaml:"stations,omitempty"`
+}
+
+// StationConfig describes a single stream to record.
+type StationConfig struct {
+	Name string `yaml:"name,omitempty"`
+
+	// URL and URLs list the station's sources in order of preference; URL
+	// is simply put first. Later entries are mirrors used while the
+	// earlier ones are down.
+	URL  string   `yaml:"url,omitempty"`
+	URLs []string `yaml:"urls,omitempty"`
+
+	Dir                 string        `yaml:"dir,omitempty"`
+	WriteBufferSize     int           `yaml:"write-buffer-size,omitempty"`
+	ReconnectBackoff    time.Duration `yaml:"reconnect-backoff,omitempty"`
+	ReconnectBackoffMax time.Duration `yaml:"reconnect-backoff-max,omitempty"`
+	MaxReconnects       int           `yaml:"max-reconnects,omitempty"`
+	MaxPermanentErrors  *int          `yaml:"max-permanent-errors,omitempty"` // nil uses the top-level value, so that 0 can disable the check
+	FailedRetryInterval time.Duration `yaml:"failed-retry-interval,omitempty"`
+	SplitInterval       time.Duration `yaml:"split-interval,omitempty"`
+	BufferSize          int           `yaml:"buffer-size,omitempty"`
+	BufferPolicy        string        `yaml:"buffer-policy,omitempty"`
+	BufferSpillDir      string        `yaml:"buffer-spill-dir,omitempty"`
+
+	MirrorRecheckInterval time.Duration `yaml:"mirror-recheck-interval,omitempty"`
+
+	IdleTimeout      time.Duration `yaml:"idle-timeout,omitempty"`
+	MinThroughput    *float64      `yaml:"min-throughput,omitempty"` // nil uses the top-level value, so that 0 can disable the check
+	ThroughputWindow time.Duration `yaml:"throughput-window,omitempty"`
+
+	TitleSeparator string            `yaml:"title-separator,omitempty"`
+	TagFrames      []string          `yaml:"tag-frames,omitempty"`
+	TagText        map[string]string `yaml:"tag-text,omitempty"`
+	TagVersion     string            `yaml:"tag-version,omitempty"`
+
+	// Connection settings passed to the shoutcast client; zero values keep
+	// the client defaults.
+	UserAgent       string            `yaml:"user-agent,omitempty"`
+	Headers         map[string]string `yaml:"headers,omitempty"`
+	DialTimeout     time.Duration     `yaml:"dial-timeout,omitempty"`
+	HeaderTimeout   time.Duration     `yaml:"header-timeout,omitempty"`
+	PlaylistTimeout time.Duration     `yaml:"playlist-timeout,omitempty"`
+	HLSMaxBandwidth int               `yaml:"hls-max-bandwidth,omitempty"` // bits per second
+
+	// MetadataCharset decodes titles that aren't valid UTF-8, such as the
+	// ISO-8859-1 or Windows-1252 sent by many European stations.
+	// ServerCharset trusts the icy-metadata-charset header instead.
+	MetadataCharset string `yaml:"metadata-charset,omitempty"`
+	ServerCharset   bool   `yaml:"server-charset,omitempty"`
 }
 
 func (cfg *Config) RegisterFlagsAndApplyDefaults(prefix string, f *flag.FlagSet) {
@@ -34,4 +136,238 @@ func (cfg *Config) RegisterFlagsAndApplyDefaults(prefix string, f *flag.FlagSet)
 		"Initial delay before reconnecting after stream disconnect. Exponential backoff is used up to reconnect-backoff-max.")
 	f.DurationVar(&cfg.ReconnectBackoffMax, util.PrefixConfig(prefix, "reconnect-backoff-max"), defaultReconnectMax,
 		"Maximum delay between reconnection attempts.")
+	f.IntVar(&cfg.MaxReconnects, util.PrefixConfig(prefix, "max-reconnects"), defaultMaxReconnects,
+		"Consecutive failed connection attempts after which a station is marked failed. Other stations keep recording.")
+	f.IntVar(&cfg.MaxPermanentErrors, util.PrefixConfig(prefix, "max-permanent-errors"), 0,
+		"Consecutive permanent errors, such as a 404 or a URL that isn't a stream, after which a station is marked failed. 0 disables the check.")
+	f.DurationVar(&cfg.FailedRetryInterval, util.PrefixConfig(prefix, "failed-retry-interval"), defaultFailedRetry,
+		"Delay before a failed station is restarted.")
+	f.DurationVar(&cfg.SplitInterval, util.PrefixConfig(prefix, "split-interval"), defaultSplitInterval,
+		"Length of each recording for streams that send no icy-metaint metadata. Files are named after the station and start time.")
+	f.IntVar(&cfg.FinalizeWorkers, util.PrefixConfig(prefix, "finalize-workers"), defaultFinalizeWorkers,
+		"Number of finished tracks flushed, synced and renamed concurrently, shared by all stations.")
+	f.IntVar(&cfg.BufferSize, util.PrefixConfig(prefix, "buffer-size"), defaultBufferSize,
+		"Bytes of audio each station buffers in memory while the disk catches up.")
+	f.StringVar(&cfg.BufferPolicy, util.PrefixConfig(prefix, "buffer-policy"), defaultBufferPolicy,
+		"What to do when a station's buffer is full: block (stop reading the stream), drop-oldest (discard audio and mark the recording damaged) or spill (overflow to a temp file).")
+	f.StringVar(&cfg.BufferSpillDir, util.PrefixConfig(prefix, "buffer-spill-dir"), "",
+		"Directory for buffer spill files. Defaults to the system temp directory.")
+	f.DurationVar(&cfg.MirrorRecheckInterval, util.PrefixConfig(prefix, "mirror-recheck-interval"), defaultMirrorRecheck,
+		"How often a station recording from a fallback mirror checks whether a preferred mirror has recovered.")
+	f.DurationVar(&cfg.IdleTimeout, util.PrefixConfig(prefix, "idle-timeout"), defaultIdleTimeout,
+		"Reconnect when a stream delivers no audio for this long.")
+	f.Float64Var(&cfg.MinThroughput, util.PrefixConfig(prefix, "min-throughput"), defaultMinThroughput,
+		"Reconnect when a stream delivers less than this fraction of its advertised icy-br over throughput-window. 0 disables the check.")
+	f.DurationVar(&cfg.ThroughputWindow, util.PrefixConfig(prefix, "throughput-window"), defaultThroughputWindow,
+		"Period over which min-throughput is measured.")
+	f.StringVar(&cfg.TitleSeparator, util.PrefixConfig(prefix, "title-separator"), defaultTitleSeparator,
+		"Separator between artist and title in stream titles, used to fill the ID3 artist (TPE1) and title (TIT2) frames.")
+	f.StringVar(&cfg.TagVersion, util.PrefixConfig(prefix, "tag-version"), defaultTagVersion,
+		"ID3 tag version: v2.4 (UTF-8), v2.3 (ISO-8859-1 or UTF-16, for older players) or v2.3+v1 (v2.3 plus an ID3v1.1 trailer).")
+}
+
+// stations returns the configured stations with the top-level defaults
+// applied. A config without a stations list but with a URL yields a single
+// station, so existing single-stream configs keep working.
+func (cfg *Config) stations() ([]StationConfig, error) {
+	list := cfg.Stations
+	if len(list) == 0 && cfg.URL != "" {
+		list = []StationConfig{{URL: cfg.URL, Dir: cfg.Dir}}
+	}
+
+	seen := make(map[string]struct{}, len(list))
+	out := make([]StationConfig, 0, len(list))
+	for i, st := range list {
+		urls := make([]string, 0, len(st.URLs)+1)
+		for _, u := range append([]string{st.URL}, st.URLs...) {
+			if u != "" && !slices.Contains(urls, u) {
+				urls = append(urls, u)
+			}
+		}
+		if len(urls) == 0 {
+			return nil, fmt.Errorf("station %d: url is required", i)
+		}
+		st.URL, st.URLs = urls[0], urls
+		if st.Name == "" {
+			st.Name = st.URL
+		}
+		if _, ok := seen[st.Name]; ok {
+			return nil, fmt.Errorf("station %q: duplicate name", st.Name)
+		}
+		seen[st.Name] = struct{}{}
+
+		if st.MetadataCharset != "" && !shoutcast.SupportedCharset(st.MetadataCharset) {
+			return nil, fmt.Errorf("station %q: unsupported metadata-charset %q", st.Name, st.MetadataCharset)
+		}
+
+		if st.Dir == "" {
+			st.Dir = cfg.Dir
+		}
+		if st.WriteBufferSize <= 0 {
+			st.WriteBufferSize = cfg.WriteBufferSize
+		}
+		if st.WriteBufferSize <= 0 {
+			st.WriteBufferSize = defaultWriteBufferSize
+		}
+		if st.ReconnectBackoff <= 0 {
+			st.ReconnectBackoff = cfg.ReconnectBackoff
+		}
+		if st.ReconnectBackoff <= 0 {
+			st.ReconnectBackoff = defaultReconnectInitial
+		}
+		if st.ReconnectBackoffMax <= 0 {
+			st.ReconnectBackoffMax = cfg.ReconnectBackoffMax
+		}
+		if st.ReconnectBackoffMax <= 0 {
+			st.ReconnectBackoffMax = defaultReconnectMax
+		}
+		if st.MaxReconnects <= 0 {
+			st.MaxReconnects = cfg.MaxReconnects
+		}
+		if st.MaxReconnects <= 0 {
+			st.MaxReconnects = defaultMaxReconnects
+		}
+		if st.MaxPermanentErrors == nil {
+			st.MaxPermanentErrors = new(cfg.MaxPermanentErrors)
+		}
+		if st.FailedRetryInterval <= 0 {
+			st.FailedRetryInterval = cfg.FailedRetryInterval
+		}
+		if st.FailedRetryInterval <= 0 {
+			st.FailedRetryInterval = defaultFailedRetry
+		}
+		if st.SplitInterval <= 0 {
+			st.SplitInterval = cfg.SplitInterval
+		}
+		if st.SplitInterval <= 0 {
+			st.SplitInterval = defaultSplitInterval
+		}
+		if st.BufferSize <= 0 {
+			st.BufferSize = cfg.BufferSize
+		}
+		if st.BufferSize <= 0 {
+			st.BufferSize = defaultBufferSize
+		}
+		if st.BufferPolicy == "" {
+			st.BufferPolicy = cfg.BufferPolicy
+		}
+		if st.BufferPolicy == "" {
+			st.BufferPolicy = defaultBufferPolicy
+		}
+		if !BufferPolicy(st.BufferPolicy).valid() {
+			return nil, fmt.Errorf("station %q: unknown buffer-policy %q", st.Name, st.BufferPolicy)
+		}
+		if st.BufferSpillDir == "" {
+			st.BufferSpillDir = cfg.BufferSpillDir
+		}
+		if st.MirrorRecheckInterval <= 0 {
+			st.MirrorRecheckInterval = cfg.MirrorRecheckInterval
+		}
+		if st.MirrorRecheckInterval <= 0 {
+			st.MirrorRecheckInterval = defaultMirrorRecheck
+		}
+		if st.IdleTimeout <= 0 {
+			st.IdleTimeout = cfg.IdleTimeout
+		}
+		if st.IdleTimeout <= 0 {
+			st.IdleTimeout = defaultIdleTimeout
+		}
+		if st.MinThroughput == nil {
+			st.MinThroughput = new(cfg.MinThroughput)
+		}
+		if st.ThroughputWindow <= 0 {
+			st.ThroughputWindow = cfg.ThroughputWindow
+		}
+		if st.ThroughputWindow <= 0 {
+			st.ThroughputWindow = defaultThroughputWindow
+		}
+		if st.TitleSeparator == "" {
+			st.TitleSeparator = cfg.TitleSeparator
+		}
+		if st.TitleSeparator == "" {
+			st.TitleSeparator = defaultTitleSeparator
+		}
+		if err := st.applyTagDefaults(cfg); err != nil {
+			return nil, fmt.Errorf("station %q: %w", st.Name, err)
+		}
+
+		out = append(out, st)
+	}
+
+	return out, nil
+}
+
+// applyTagDefaults resolves the station's tag settings against the
+// top-level ones and checks them.
+func (st *StationConfig) applyTagDefaults(cfg *Config) error {
+	if st.TagVersion == "" {
+		st.TagVersion = cfg.TagVersion
+	}
+	if st.TagVersion == "" {
+		st.TagVersion = defaultTagVersion
+	}
+	switch st.TagVersion {
+	case tagV24, tagV23, tagV23V1:
+	default:
+		return fmt.Errorf("unknown tag-version %q", st.TagVersion)
+	}
+
+	frames := st.TagFrames
+	if frames == nil {
+		frames = cfg.TagFrames
+	}
+	if frames == nil {
+		frames = defaultTagFrames
+	}
+	st.TagFrames = make([]string, 0, len(frames))
+	for _, id := range frames {
+		id = strings.ToUpper(id)
+		if !slices.Contains(tagFrames, id) {
+			return fmt.Errorf("unsupported tag-frames entry %q", id)
+		}
+		st.TagFrames = append(st.TagFrames, id)
+	}
+
+	text := make(map[string]string, len(cfg.TagText)+len(st.TagText))
+	for _, m := range []map[string]string{cfg.TagText, st.TagText} {
+		for id, v := range m {
+			id = strings.ToUpper(id)
+			if !id3.ValidID(id) || id[0] != 'T' || id == "TXXX" {
+				return fmt.Errorf("tag-text key %q is not a text frame ID", id)
+			}
+			text[id] = v
+		}
+	}
+	st.TagText = text
+	return nil
+}
+
+// streamOptions returns the shoutcast client options for the station.
+func (st *StationConfig) streamOptions(logger *slog.Logger) []shoutcast.Option {
+	opts := []shoutcast.Option{shoutcast.WithLogger(logger)}
+	if st.UserAgent != "" {
+		opts = append(opts, shoutcast.WithUserAgent(st.UserAgent))
+	}
+	for k, v := range st.Headers {
+		opts = append(opts, shoutcast.WithHeader(k, v))
+	}
+	if st.DialTimeout > 0 {
+		opts = append(opts, shoutcast.WithDialTimeout(st.DialTimeout))
+	}
+	if st.HeaderTimeout > 0 {
+		opts = append(opts, shoutcast.WithHeaderTimeout(st.HeaderTimeout))
+	}
+	if st.PlaylistTimeout > 0 {
+		opts = append(opts, shoutcast.WithPlaylistTimeout(st.PlaylistTimeout))
+	}
+	if st.HLSMaxBandwidth > 0 {
+		opts = append(opts, shoutcast.WithHLSMaxBandwidth(st.HLSMaxBandwidth))
+	}
+	if st.MetadataCharset != "" {
+		opts = append(opts, shoutcast.WithMetadataCharset(st.MetadataCharset))
+	}
+	if st.ServerCharset {
+		opts = append(opts, shoutcast.WithServerCharset(true))
+	}
+	return opts
 }
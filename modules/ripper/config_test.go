@@ -0,0 +1,52 @@
+package ripper
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TestStationsDisabledChecks checks that a station can turn off a check
+// the top level turns on by setting it to 0, and that leaving it out takes
+// the top-level value.
+func TestStationsDisabledChecks(t *testing.T) {
+	const doc = `
+max-permanent-errors: 3
+min-throughput: 0.5
+stations:
+  - name: inherits
+    url: http://a.example.com/
+  - name: disabled
+    url: http://b.example.com/
+    max-permanent-errors: 0
+    min-throughput: 0
+  - name: own
+    url: http://c.example.com/
+    max-permanent-errors: 5
+    min-throughput: 0.8
+`
+	var cfg Config
+	if err := yaml.UnmarshalStrict([]byte(doc), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	stations, err := cfg.stations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]struct {
+		maxPermanentErrors int
+		minThroughput      float64
+	}{
+		"inherits": {3, 0.5},
+		"disabled": {0, 0},
+		"own":      {5, 0.8},
+	}
+	for _, st := range stations {
+		w := want[st.Name]
+		if *st.MaxPermanentErrors != w.maxPermanentErrors || *st.MinThroughput != w.minThroughput {
+			t.Errorf("%s: max-permanent-errors %d, min-throughput %v, want %d, %v",
+				st.Name, *st.MaxPermanentErrors, *st.MinThroughput, w.maxPermanentErrors, w.minThroughput)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ripper
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// finalizeQueuePerWorker sizes the finalizer queue relative to the number of
+// workers. Tracks only end every few minutes, so a short queue is plenty;
+// when it is full the station's file writer waits, which the ChannelWriter
+// buffer absorbs without stalling the network reader.
+const finalizeQueuePerWorker = 4
+
+// finalizer commits finished tracks on a bounded pool of workers shared by
+// all stations. Flushing, syncing and renaming a file can take seconds on
+// network filesystems, so it happens off the recording path.
+type finalizer struct {
+	logger *slog.Logger
+	jobs   chan committer
+	wg     sync.WaitGroup
+}
+
+// committer is a finished track waiting to be committed; in the ripper
+// always a *fileWriter.
+type committer interface {
+	commit()
+}
+
+func newFinalizer(workers int, logger *slog.Logger) *finalizer {
+	if workers < 1 {
+		workers = 1
+	}
+
+	f := &finalizer{
+		logger: logger,
+		jobs:   make(chan committer, workers*finalizeQueuePerWorker),
+	}
+
+	for range workers {
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			f.work()
+		}()
+	}
+
+	return f
+}
+
+func (f *finalizer) work() {
+	for c := range f.jobs {
+		metricFinalizeQueueLength.Dec()
+		start := time.Now()
+		c.commit()
+		metricFinalizeDuration.Observe(time.Since(start).Seconds())
+	}
+}
+
+// submit queues c to be committed. It blocks while the queue is full.
+func (f *finalizer) submit(c committer) {
+	metricFinalizeQueueLength.Inc()
+	f.jobs <- c
+}
+
+// close waits for every queued track to be committed. submit must not be
+// called afterwards.
+func (f *finalizer) close() {
+	close(f.jobs)
+	f.wg.Wait()
+}
@@ -0,0 +1,96 @@
+package ripper
+
+import (
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCommit records its id when committed, after waiting for release.
+type fakeCommit struct {
+	id      int
+	release <-chan struct{}
+	mu      *sync.Mutex
+	done    *[]int
+}
+
+func (c *fakeCommit) commit() {
+	<-c.release
+	c.mu.Lock()
+	*c.done = append(*c.done, c.id)
+	c.mu.Unlock()
+}
+
+// TestFinalizerSlowCommits checks that commits slower than tracks are
+// submitted, with the queue full, each run exactly once.
+func TestFinalizerSlowCommits(t *testing.T) {
+	const jobs = 50
+	f := newFinalizer(2, slog.New(slog.DiscardHandler))
+
+	var mu sync.Mutex
+	var done []int
+	release := make(chan struct{})
+	go func() {
+		// Let the queue fill up and submit block before any commit ends,
+		// then commit slowly.
+		time.Sleep(20 * time.Millisecond)
+		for range jobs {
+			release <- struct{}{}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	for i := range jobs {
+		f.submit(&fakeCommit{id: i, release: release, mu: &mu, done: &done})
+	}
+	f.close()
+
+	seen := make(map[int]int)
+	for _, id := range done {
+		seen[id]++
+	}
+	for i := range jobs {
+		if seen[i] != 1 {
+			t.Errorf("track %d committed %d times, want once", i, seen[i])
+		}
+	}
+	if len(done) != jobs {
+		t.Errorf("%d commits, want %d", len(done), jobs)
+	}
+}
+
+// TestFinalizerCloseWaits checks that close returns only once the commits
+// in progress and those still queued are done.
+func TestFinalizerCloseWaits(t *testing.T) {
+	f := newFinalizer(1, slog.New(slog.DiscardHandler))
+
+	var mu sync.Mutex
+	var done []int
+	release := make(chan struct{})
+	for i := range 3 {
+		f.submit(&fakeCommit{id: i, release: release, mu: &mu, done: &done})
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		f.close()
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("close returned with commits in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close didn't return once the commits were done")
+	}
+	if len(done) != 3 {
+		t.Errorf("%d commits when close returned, want 3", len(done))
+	}
+}
@@ -1,42 +1,141 @@
 package ripper
 
-import "io"
-
-// writeID3v2Tag writes a minimal ID3v2.4 tag containing a single TIT2 (title)
-// frame to w. The title is encoded as UTF-8 (text encoding byte 0x03).
-func writeID3v2Tag(w io.Writer, title string) error {
-	// Frame content: encoding byte (0x03 = UTF-8) + title bytes
-	titleBytes := []byte(title)
-	frameContent := make([]byte, 1+len(titleBytes))
-	frameContent[0] = 0x03 // UTF-8
-	copy(frameContent[1:], titleBytes)
-
-	// TIT2 frame: 4-byte ID + 4-byte big-endian size + 2-byte flags + content
-	frameSize := len(frameContent)
-	frame := make([]byte, 10+frameSize)
-	copy(frame[0:4], "TIT2")
-	frame[4] = byte(frameSize >> 24)
-	frame[5] = byte(frameSize >> 16)
-	frame[6] = byte(frameSize >> 8)
-	frame[7] = byte(frameSize)
-	// flags: 0x00 0x00
-	copy(frame[10:], frameContent)
-
-	// ID3v2.4 tag header: "ID3" + version (0x04 0x00) + flags (0x00) + synchsafe size
-	tagContentSize := len(frame)
-	header := [10]byte{}
-	copy(header[0:3], "ID3")
-	header[3] = 0x04 // version 2.4
-	// header[4] = revision 0x00, header[5] = flags 0x00 (already zero)
-	// Encode tag content size as synchsafe integer (7 bits per byte)
-	header[6] = byte((tagContentSize >> 21) & 0x7F)
-	header[7] = byte((tagContentSize >> 14) & 0x7F)
-	header[8] = byte((tagContentSize >> 7) & 0x7F)
-	header[9] = byte(tagContentSize & 0x7F)
-
-	if _, err := w.Write(header[:]); err != nil {
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zachfi/streamgo/pkg/id3"
+)
+
+// Values of tag-version.
+const (
+	tagV24   = "v2.4"
+	tagV23   = "v2.3"
+	tagV23V1 = "v2.3+v1" // with an ID3v1.1 trailer
+)
+
+// id3Padding is the room left in a tag for the frames only known once the
+// recording is finished, so the tag can be rewritten in place.
+const id3Padding = 256
+
+// id3TimeFormat is the ID3v2.4 timestamp format; times are in UTC. ID3v2.3
+// tags get the same time split into TYER, TDAT and TIME.
+const id3TimeFormat = "2006-01-02T15:04:05"
+
+// tagFrames are the frames the ripper knows how to fill. They are written
+// in the order tag-frames lists them, followed by the tag-text frames:
+//
+//	TPE1       artist, the part of the stream title before title-separator
+//	TIT2       title, the rest of the stream title
+//	TALB/TPE2  album or album artist, the stream's icy-name
+//	TCON       genre, the stream's icy-genre
+//	TDRC/TDRL  recording and release time, when the track started
+//	WOAS       the stream URL recorded from
+//	WORS       the station's homepage (icy-url), or else the stream URL
+//	TLEN       length in milliseconds
+//	COMM       the stream title as sent by the station
+//	TXXX       the bitrate, samplerate and channels the server announced
+var tagFrames = []string{"TPE1", "TIT2", "TALB", "TPE2", "TCON", "TDRC", "TDRL", "WOAS", "WORS", "TLEN", "COMM", "TXXX"}
+
+// defaultTagFrames are the frames written unless tag-frames says otherwise.
+var defaultTagFrames = []string{"TPE1", "TIT2", "TALB", "TCON", "TDRC", "TDRL", "WOAS", "WORS", "TLEN", "COMM", "TXXX"}
+
+// splitStreamTitle splits an "Artist - Title" stream title at the first
+// sep. A title without sep is all title.
+func splitStreamTitle(s, sep string) (artist, title string) {
+	if sep != "" {
+		if a, t, ok := strings.Cut(s, sep); ok && strings.TrimSpace(a) != "" && strings.TrimSpace(t) != "" {
+			return strings.TrimSpace(a), strings.TrimSpace(t)
+		}
+	}
+	return "", strings.TrimSpace(s)
+}
+
+// id3Tag builds the tag for t from the station's tag settings. TLEN is
+// added on commit, once the duration is known.
+func (s *station) id3Tag(t *track) *id3.Tag {
+	tag := id3.New()
+	if s.cfg.TagVersion != tagV24 {
+		tag.Version = id3.V23
+	}
+
+	// Without TPE1 the title keeps the artist, rather than losing it.
+	artist, title := "", t.title
+	if t.icyTitle != "" && slices.Contains(s.cfg.TagFrames, "TPE1") {
+		artist, title = splitStreamTitle(t.icyTitle, s.cfg.TitleSeparator)
+	}
+
+	for _, id := range s.cfg.TagFrames {
+		switch id {
+		case "TPE1":
+			tag.SetText(id, artist)
+		case "TIT2":
+			tag.SetText(id, title)
+		case "TALB", "TPE2":
+			tag.SetText(id, t.src.name)
+		case "TCON":
+			tag.SetText(id, t.src.genre)
+		case "TDRC", "TDRL":
+			tag.SetText(id, t.time.UTC().Format(id3TimeFormat))
+		case "WOAS":
+			tag.SetURL(id, t.src.url)
+		case "WORS":
+			tag.SetURL(id, cmp.Or(t.src.homepage, t.src.url))
+		case "COMM":
+			tag.SetComment("eng", "", t.icyTitle)
+		case "TXXX":
+			setNumber(tag, "bitrate", t.src.bitrate)
+			setNumber(tag, "samplerate", t.src.sampleRate)
+			setNumber(tag, "channels", t.src.channels)
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(s.cfg.TagText)) {
+		tag.SetText(id, s.cfg.TagText[id])
+	}
+	return tag
+}
+
+// setNumber sets the user text frame desc to n, unless n is unknown.
+func setNumber(tag *id3.Tag, desc string, n int) {
+	if n > 0 {
+		tag.SetUserText(desc, strconv.Itoa(n))
+	}
+}
+
+// writeTag writes the tag for the track at the start of the file, leaving
+// id3Padding bytes spare.
+func (fw *fileWriter) writeTag() error {
+	tag := fw.s.id3Tag(fw.t)
+	b := tag.Encode(0)
+	b = tag.Encode(len(b) + id3Padding)
+	if _, err := fw.f.Write(b); err != nil {
 		return err
 	}
-	_, err := w.Write(frame)
-	return err
+	fw.tag, fw.tagSize = tag, len(b)
+	return nil
+}
+
+// commitTag rewrites the tag in place with the recording's length and,
+// if configured, appends an ID3v1 trailer. The file must be positioned at
+// its end.
+func (fw *fileWriter) commitTag() error {
+	if fw.duration > 0 && slices.Contains(fw.s.cfg.TagFrames, "TLEN") {
+		fw.tag.SetText("TLEN", strconv.FormatInt(fw.duration.Milliseconds(), 10))
+		if b := fw.tag.Encode(fw.tagSize); len(b) != fw.tagSize {
+			fw.s.logger.Warn("tag outgrew its padding, leaving out TLEN", "path", fw.destPath)
+		} else if _, err := fw.f.WriteAt(b, 0); err != nil {
+			return err
+		}
+	}
+
+	if fw.s.cfg.TagVersion == tagV23V1 {
+		if _, err := fw.f.Write(fw.tag.EncodeV1()); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,116 @@
+package ripper
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "streamgo"
+
+var (
+	metricStationUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "station_up",
+		Help:      "Whether the station recording service is running (1) or not (0).",
+	}, []string{"station"})
+
+	metricStationFailed = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "station_failed",
+		Help:      "Whether the station is in the failed state and waiting to be restarted.",
+	}, []string{"station"})
+
+	metricStationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "station_failures_total",
+		Help:      "Number of times the station service has failed.",
+	}, []string{"station"})
+
+	metricFinalizeQueueLength = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "finalize_queue_length",
+		Help:      "Number of finished tracks waiting to be committed.",
+	})
+
+	metricFinalizeDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "finalize_duration_seconds",
+		Help:      "Time taken to flush, sync and rename a finished track.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+	})
+
+	metricBufferBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "buffer_bytes",
+		Help:      "Audio bytes buffered in memory waiting to be written.",
+	}, []string{"station"})
+
+	metricBufferSpilledBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "buffer_spilled_bytes",
+		Help:      "Audio bytes spilled to a temporary file waiting to be written.",
+	}, []string{"station"})
+
+	metricBufferDroppedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "buffer_dropped_bytes_total",
+		Help:      "Audio bytes discarded because the buffer was full.",
+	}, []string{"station"})
+
+	metricDamagedRecordings = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "damaged_recordings_total",
+		Help:      "Recordings saved with audio missing because the buffer dropped data.",
+	}, []string{"station"})
+
+	metricMirrorActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "mirror_active",
+		Help:      "Whether the station is currently recording from this mirror (1) or not (0).",
+	}, []string{"station", "url"})
+
+	metricMirrorFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "mirror_failures_total",
+		Help:      "Failed connects, dropped connections and failed health checks per mirror.",
+	}, []string{"station", "url"})
+
+	metricMirrorTTFB = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "mirror_ttfb_seconds",
+		Help:      "Time until the mirror answered the last successful connect or health check.",
+	}, []string{"station", "url"})
+
+	metricMirrorThroughput = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "mirror_throughput_bytes_per_second",
+		Help:      "Average rate audio was received at over the last connection to the mirror.",
+	}, []string{"station", "url"})
+
+	metricStalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "stalls_total",
+		Help:      "Connections dropped by the watchdog, by reason: idle (no audio) or slow (below min-throughput).",
+	}, []string{"station", "reason"})
+
+	metricStreamInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: module,
+		Name:      "stream_info",
+		Help:      "Audio parameters announced by the station's current connection; always 1. Zero means unknown.",
+	}, []string{"station", "content_type", "bitrate", "samplerate", "channels"})
+)
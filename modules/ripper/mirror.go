@@ -0,0 +1,203 @@
+package ripper
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/zachfi/streamgo/pkg/shoutcast"
+)
+
+// mirrorJitter is the fraction by which cooldowns are randomly shortened or
+// lengthened, so that many stations don't reconnect in lockstep.
+const mirrorJitter = 0.2
+
+// mirrorSlowTTFB is how long a mirror may take to answer a connect before it
+// is ranked behind mirrors that answer faster.
+const mirrorSlowTTFB = 5 * time.Second
+
+// mirror tracks the health of one of a station's source URLs.
+type mirror struct {
+	url   string
+	index int // position in the configured order; 0 is preferred
+
+	failures   int           // consecutive failed connects or dropped connections
+	retryAt    time.Time     // the mirror is avoided until then
+	ttfb       time.Duration // time until the last successful connect answered
+	bitrate    int           // icy-br in kbps at the last connect, 0 if unknown
+	throughput float64       // bytes per second over the last connection
+	slowAt     time.Time     // when throughput was last below minRatio of bitrate
+}
+
+// mirrorSet ranks a station's mirrors. Mirrors are preferred in configured
+// order; one that failed recently is skipped until its cooldown, which grows
+// with each consecutive failure, has passed. Permanent errors such as a 404
+// go straight to the longest cooldown, and a Retry-After from the server is
+// always honored.
+//
+// A mirror that works but is degraded is ranked behind healthy ones: one
+// that took longer than mirrorSlowTTFB to answer its last connect, or one
+// whose last connection delivered less than minRatio (min-throughput) of its
+// advertised bitrate. The latter is forgiven after demotion, the station's
+// mirror-recheck-interval.
+type mirrorSet struct {
+	mu         sync.Mutex
+	station    string
+	mirrors    []*mirror
+	active     *mirror
+	backoff    time.Duration
+	backoffMax time.Duration
+	minRatio   float64
+	demotion   time.Duration
+}
+
+func newMirrorSet(station string, urls []string, backoff, backoffMax time.Duration, minRatio float64, demotion time.Duration) *mirrorSet {
+	ms := &mirrorSet{
+		station:    station,
+		backoff:    backoff,
+		backoffMax: backoffMax,
+		minRatio:   minRatio,
+		demotion:   demotion,
+	}
+	for i, u := range urls {
+		ms.mirrors = append(ms.mirrors, &mirror{url: u, index: i})
+		metricMirrorActive.WithLabelValues(station, u).Set(0)
+	}
+	return ms
+}
+
+// cooldown returns how long m is avoided after failing with err.
+func (ms *mirrorSet) cooldown(m *mirror, err error) time.Duration {
+	d := ms.backoff
+	for i := 1; i < m.failures && d < ms.backoffMax; i++ {
+		d *= 2
+	}
+	d = min(d, ms.backoffMax)
+	if shoutcast.IsPermanent(err) {
+		d = ms.backoffMax
+	}
+
+	d = time.Duration(float64(d) * (1 - mirrorJitter + 2*mirrorJitter*rand.Float64()))
+
+	return max(d, shoutcast.RetryAfter(err))
+}
+
+// degraded reports whether m answered slowly or delivered audio too slowly
+// the last time it was used. The caller must hold the lock.
+func (ms *mirrorSet) degraded(m *mirror, now time.Time) bool {
+	return m.ttfb > mirrorSlowTTFB || (!m.slowAt.IsZero() && now.Sub(m.slowAt) < ms.demotion)
+}
+
+// pick returns the mirror to connect to next: the first healthy one in
+// configured order that isn't cooling down, or else the first degraded one.
+// When every mirror is cooling down it returns the one that is ready
+// soonest and how long to wait for it.
+func (ms *mirrorSet) pick() (*mirror, time.Duration) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+	var best, fallback *mirror
+	var bestWait time.Duration
+	for _, m := range ms.mirrors {
+		wait := m.retryAt.Sub(now)
+		if wait <= 0 {
+			if !ms.degraded(m, now) {
+				return m, 0
+			}
+			if fallback == nil {
+				fallback = m
+			}
+			continue
+		}
+		if best == nil || wait < bestWait {
+			best, bestWait = m, wait
+		}
+	}
+	if fallback != nil {
+		return fallback, 0
+	}
+	return best, bestWait
+}
+
+// better returns the mirrors that pick would rank above the active one and
+// that are out of their cooldown: healthy mirrors preferred over it, and
+// any healthy mirror if it is degraded itself.
+func (ms *mirrorSet) better() []*mirror {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.active == nil {
+		return nil
+	}
+	now := time.Now()
+	candidates := ms.mirrors[:ms.active.index]
+	if ms.degraded(ms.active, now) {
+		candidates = ms.mirrors
+	}
+	var out []*mirror
+	for _, m := range candidates {
+		if m != ms.active && !now.Before(m.retryAt) && !ms.degraded(m, now) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// connected records a successful connect to m, which becomes the active
+// mirror. bitrate is the stream's advertised bitrate in kbps.
+func (ms *mirrorSet) connected(m *mirror, ttfb time.Duration, bitrate int) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	m.failures = 0
+	m.ttfb = ttfb
+	m.bitrate = bitrate
+	metricMirrorTTFB.WithLabelValues(ms.station, m.url).Set(ttfb.Seconds())
+
+	if ms.active != nil {
+		metricMirrorActive.WithLabelValues(ms.station, ms.active.url).Set(0)
+	}
+	ms.active = m
+	metricMirrorActive.WithLabelValues(ms.station, m.url).Set(1)
+}
+
+// recovered records a successful health check of a mirror that isn't
+// active.
+func (ms *mirrorSet) recovered(m *mirror, ttfb time.Duration) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	m.failures = 0
+	m.ttfb = ttfb
+	metricMirrorTTFB.WithLabelValues(ms.station, m.url).Set(ttfb.Seconds())
+}
+
+// disconnected records the end of a connection to m after n bytes over d.
+func (ms *mirrorSet) disconnected(m *mirror, n int64, d time.Duration) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if d > 0 {
+		m.throughput = float64(n) / d.Seconds()
+		metricMirrorThroughput.WithLabelValues(ms.station, m.url).Set(m.throughput)
+		if m.bitrate > 0 && m.throughput < ms.minRatio*float64(m.bitrate)*1000/8 {
+			m.slowAt = time.Now()
+		}
+	}
+	if ms.active == m {
+		ms.active = nil
+		metricMirrorActive.WithLabelValues(ms.station, m.url).Set(0)
+	}
+}
+
+// failed records a failed connect, a dropped connection or a failed health
+// check of m. err is nil for a dropped connection.
+func (ms *mirrorSet) failed(m *mirror, err error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	m.failures++
+	m.retryAt = time.Now().Add(ms.cooldown(m, err))
+	metricMirrorFailures.WithLabelValues(ms.station, m.url).Inc()
+}
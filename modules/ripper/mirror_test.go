@@ -0,0 +1,100 @@
+package ripper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMirrorSetPick(t *testing.T) {
+	urls := []string{"http://a/", "http://b/", "http://c/"}
+
+	tests := []struct {
+		name  string
+		setup func(ms *mirrorSet)
+		want  string
+	}{
+		{
+			name:  "preferred",
+			setup: func(*mirrorSet) {},
+			want:  "http://a/",
+		},
+		{
+			name: "failed preferred",
+			setup: func(ms *mirrorSet) {
+				ms.failed(ms.mirrors[0], nil)
+			},
+			want: "http://b/",
+		},
+		{
+			name: "slow to answer",
+			setup: func(ms *mirrorSet) {
+				ms.recovered(ms.mirrors[0], 2*mirrorSlowTTFB)
+			},
+			want: "http://b/",
+		},
+		{
+			name: "low throughput",
+			setup: func(ms *mirrorSet) {
+				a := ms.mirrors[0]
+				ms.connected(a, time.Second, 128)
+				ms.disconnected(a, 128*1000/8*10/4, 10*time.Second) // a quarter of 128 kbps
+			},
+			want: "http://b/",
+		},
+		{
+			name: "enough throughput",
+			setup: func(ms *mirrorSet) {
+				a := ms.mirrors[0]
+				ms.connected(a, time.Second, 128)
+				ms.disconnected(a, 128*1000/8*10, 10*time.Second)
+			},
+			want: "http://a/",
+		},
+		{
+			name: "all degraded",
+			setup: func(ms *mirrorSet) {
+				for _, m := range ms.mirrors {
+					ms.recovered(m, 2*mirrorSlowTTFB)
+				}
+			},
+			want: "http://a/",
+		},
+		{
+			name: "degraded beats cooling down",
+			setup: func(ms *mirrorSet) {
+				ms.failed(ms.mirrors[0], nil)
+				ms.failed(ms.mirrors[1], nil)
+				ms.recovered(ms.mirrors[2], 2*mirrorSlowTTFB)
+			},
+			want: "http://c/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := newMirrorSet("test", urls, time.Minute, time.Hour, 0.5, time.Hour)
+			tt.setup(ms)
+			if m, wait := ms.pick(); m.url != tt.want || wait != 0 {
+				t.Errorf("pick() = %s after %v, want %s now", m.url, wait, tt.want)
+			}
+		})
+	}
+}
+
+func TestMirrorSetBetter(t *testing.T) {
+	ms := newMirrorSet("test", []string{"http://a/", "http://b/", "http://c/"}, time.Minute, time.Hour, 0.5, time.Hour)
+	a, b, c := ms.mirrors[0], ms.mirrors[1], ms.mirrors[2]
+
+	// On b, a is worth rechecking; c is not.
+	ms.connected(b, time.Second, 128)
+	if got := ms.better(); len(got) != 1 || got[0] != a {
+		t.Errorf("better() on a healthy fallback = %v, want [a]", got)
+	}
+
+	// Once b turns out slow, c is worth moving to as well.
+	ms.disconnected(b, 0, 10*time.Second)
+	ms.connected(b, time.Second, 128)
+	if got := ms.better(); len(got) != 2 || got[0] != a || got[1] != c {
+		t.Errorf("better() on a degraded fallback = %v, want [a c]", got)
+	}
+}
@@ -2,39 +2,34 @@ package ripper
 
 import (
 	"context"
-	"errors"
-	"io"
 	"log/slog"
-	"os"
-	"path"
 	"sync"
-	"time"
 
 	"github.com/grafana/dskit/services"
-
-	"github.com/zachfi/streamgo/pkg/shoutcast"
 )
 
 type Ripper struct {
 	services.Service
-	cfg         *Config
-	logger      *slog.Logger
-	stream      *shoutcast.Stream
-	streamMutex sync.Mutex // protects stream for replace and close
-	w           *ChannelWriter
-	copyWg      sync.WaitGroup // signals when the io.Copy goroutine has exited
+	cfg      *Config
+	logger   *slog.Logger
+	stations []StationConfig
+	fin      *finalizer
+	wg       sync.WaitGroup // tracks the per-station supervisors
 }
 
 var module = "ripper"
 
 // New creates and returns a new.
 func New(cfg Config, logger slog.Logger) (*Ripper, error) {
-	if cfg.WriteBufferSize == 0 {
-		cfg.WriteBufferSize = defaultWriteBufferSize
+	stations, err := cfg.stations()
+	if err != nil {
+		return nil, err
 	}
+
 	r := &Ripper{
-		cfg:    &cfg,
-		logger: logger.With("module", module),
+		cfg:      &cfg,
+		logger:   logger.With("module", module),
+		stations: stations,
 	}
 
 	r.Service = services.NewBasicService(r.starting, r.running, r.stopping)
@@ -43,323 +38,67 @@ func New(cfg Config, logger slog.Logger) (*Ripper, error) {
 }
 
 func (r *Ripper) starting(ctx context.Context) error {
+	r.fin = newFinalizer(r.cfg.FinalizeWorkers, r.logger)
 	return nil
 }
 
 func (r *Ripper) running(ctx context.Context) error {
-	var f *os.File
-	var wCtx context.Context
-	var cancel context.CancelFunc
-	var writerDone chan struct{} // closed when the current writer goroutine exits
-
-	bufferMutex := &sync.Mutex{}
-
-	cw := NewChannelWriter()
-	r.w = cw
-
-	initialBackoff := r.cfg.ReconnectBackoff
-	if initialBackoff <= 0 {
-		initialBackoff = 5 * time.Second
-	}
-	maxBackoff := r.cfg.ReconnectBackoffMax
-	if maxBackoff <= 0 {
-		maxBackoff = 60 * time.Second
+	if len(r.stations) == 0 {
+		r.logger.Warn("no stations configured")
 	}
 
-	fileName := ""
-
-	metadataCallback := func(stream *shoutcast.Stream) func(m *shoutcast.Metadata) {
-		return func(m *shoutcast.Metadata) {
-			r.logger.Info("now listening to", "title", m.StreamTitle)
-
-			var name string
-			if r.cfg.Dir != "" {
-				name = path.Join(r.cfg.Dir, stream.Name, m.StreamTitle+".mp3")
-			} else {
-				name = path.Join(stream.Name, m.StreamTitle+".mp3")
-			}
-
-			err := os.MkdirAll(path.Dir(name), os.ModePerm)
-			if err != nil {
-				r.logger.Error("error creating stream directory", "err", err)
-			}
-
-			if name != fileName {
-				fileName = name
-
-				if cancel != nil {
-					cancel()
-				}
-				if writerDone != nil {
-					<-writerDone
-				}
-
-				dir := path.Dir(name)
-				tmpF, err := os.CreateTemp(dir, "*.mp3.tmp")
-				if err != nil {
-					r.logger.Error("error creating temp file", "err", err)
-					return
-				}
-				if err := writeID3v2Tag(tmpF, m.StreamTitle); err != nil {
-					r.logger.Error("error writing ID3 tag", "err", err)
-				}
-				f = tmpF
-
-				wCtx, cancel = context.WithCancel(ctx)
-				writerDone = make(chan struct{})
-				done := writerDone
-				r.logger.Debug("starting new writer")
-				go func() {
-					defer close(done)
-					r.writeToFile(wCtx, cw.dataChan, bufferMutex, f, name)
-				}()
-			}
-		}
+	for _, cfg := range r.stations {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.supervise(ctx, cfg)
+		}()
 	}
 
-	r.copyWg.Add(1)
-	go func() {
-		defer r.copyWg.Done()
-		backoff := initialBackoff
-		for {
-			if ctx.Err() != nil {
-				return
-			}
-			stream, err := shoutcast.Open(r.cfg.URL)
-			if err != nil {
-				r.logger.Error("error opening stream, reconnecting", "err", err, "backoff", backoff)
-				if r.sleepCtx(ctx, backoff) != nil {
-					return
-				}
-				if backoff < maxBackoff {
-					backoff = min(backoff*2, maxBackoff)
-				}
-				continue
-			}
-			backoff = initialBackoff // reset after successful connect
-
-			stream.MetadataCallbackFunc = metadataCallback(stream)
-			r.streamMutex.Lock()
-			r.stream = stream
-			r.streamMutex.Unlock()
-
-			r.logger.Info("stream connected, copying")
-			_, copyErr := io.Copy(cw, stream)
-
-			r.streamMutex.Lock()
-			if r.stream == stream {
-				r.stream = nil
-			}
-			_ = stream.Close()
-			r.streamMutex.Unlock()
-
-			if copyErr != nil && copyErr != io.EOF {
-				r.logger.Warn("stream disconnected, reconnecting", "err", copyErr, "backoff", backoff)
-			}
-			if ctx.Err() != nil {
-				return
-			}
-			if r.sleepCtx(ctx, backoff) != nil {
-				return
-			}
-			if backoff < maxBackoff {
-				backoff = min(backoff*2, maxBackoff)
-			}
-		}
-	}()
-
 	<-ctx.Done()
 	return nil
 }
 
-// sleepCtx sleeps for d or until ctx is done. Returns ctx.Err() if context was cancelled.
-func (r *Ripper) sleepCtx(ctx context.Context, d time.Duration) error {
-	t := time.NewTimer(d)
-	defer t.Stop()
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-t.C:
-		return nil
-	}
-}
-
-func (r *Ripper) stopping(_ error) error {
-	r.logger.Info("stopping")
+// supervise runs the station as a child service until ctx is cancelled. A
+// failed station is restarted after FailedRetryInterval; its failure never
+// reaches the service manager, so other stations keep recording.
+func (r *Ripper) supervise(ctx context.Context, cfg StationConfig) {
+	logger := r.logger.With("station", cfg.Name)
 
-	var errs []error
-	// Close stream so io.Copy unblocks and the copy goroutine can exit; then wait for it.
-	r.streamMutex.Lock()
-	if r.stream != nil {
-		if err := r.stream.Close(); err != nil {
-			errs = append(errs, err)
+	for {
+		s := newStation(cfg, r.logger, r.fin)
+		if err := s.StartAsync(ctx); err != nil {
+			logger.Error("failed to start station", "err", err)
+			return
 		}
-		r.stream = nil
-	}
-	r.streamMutex.Unlock()
-	r.copyWg.Wait()
+		metricStationFailed.WithLabelValues(cfg.Name).Set(0)
 
-	if r.w != nil {
-		if err := r.w.Close(); err != nil {
-			errs = append(errs, err)
+		_ = s.AwaitTerminated(context.Background())
+		if ctx.Err() != nil {
+			return
 		}
-	}
 
-	if len(errs) > 0 {
-		return errors.Join(errs...)
-	}
-	return nil
-}
+		metricStationFailures.WithLabelValues(cfg.Name).Inc()
+		metricStationFailed.WithLabelValues(cfg.Name).Set(1)
+		logger.Error("station failed, will retry", "err", s.FailureCase(), "retry_in", cfg.FailedRetryInterval)
 
-// commitTempFile renames tempPath to destPath only if dest doesn't exist or
-// the temp file is larger (so a previous crash doesn't overwrite a good recording).
-func (r *Ripper) commitTempFile(tempPath, destPath string) {
-	tempInfo, err := os.Stat(tempPath)
-	if err != nil {
-		r.logger.Error("error stating temp file", "err", err, "path", tempPath)
-		_ = os.Remove(tempPath)
-		return
-	}
-	destInfo, err := os.Stat(destPath)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			r.logger.Error("error stating dest file", "err", err, "path", destPath)
-			_ = os.Remove(tempPath)
-			return
-		}
-		// Dest doesn't exist; use the temp file.
-		if err := os.Rename(tempPath, destPath); err != nil {
-			r.logger.Error("error renaming temp to dest", "err", err, "temp", tempPath, "dest", destPath)
-			_ = os.Remove(tempPath)
-			return
-		}
-		r.logger.Debug("saved new recording", "path", destPath)
-		return
-	}
-	if tempInfo.Size() > destInfo.Size() {
-		if err := os.Rename(tempPath, destPath); err != nil {
-			r.logger.Error("error renaming temp to dest", "err", err, "temp", tempPath, "dest", destPath)
-			_ = os.Remove(tempPath)
+		if sleepCtx(ctx, cfg.FailedRetryInterval) != nil {
 			return
 		}
-		r.logger.Debug("overwrote with longer recording", "path", destPath, "size", tempInfo.Size())
-	} else {
-		_ = os.Remove(tempPath)
-		r.logger.Debug("discarded shorter recording", "path", destPath, "temp_size", tempInfo.Size(), "existing_size", destInfo.Size())
+		logger.Info("restarting failed station")
 	}
 }
 
-// minWriteBufSize and maxWriteBufSize clamp the configured write buffer to avoid
-// tiny writes (no benefit) or very large buffers (memory and latency).
-const (
-	minWriteBufSize = 32 * 1024   // 32 KiB
-	maxWriteBufSize = 4 * 1024 * 1024 // 4 MiB
-)
-
-func (r *Ripper) writeToFile(ctx context.Context, dataChan chan []byte, bufferMutex *sync.Mutex, f *os.File, destPath string) {
-	writeBufSize := r.cfg.WriteBufferSize
-	if writeBufSize < minWriteBufSize {
-		writeBufSize = minWriteBufSize
-	}
-	if writeBufSize > maxWriteBufSize {
-		writeBufSize = maxWriteBufSize
-	}
-
-	var err error
-	firstWrite := true
-	buffer := make([]byte, 0, 4096)       // Buffer to accumulate data until we find frame sync
-	writeBuf := make([]byte, 0, writeBufSize) // Batch writes to reduce disk I/O
-
-	flushWriteBuf := func() {
-		if len(writeBuf) == 0 {
-			return
-		}
-		bufferMutex.Lock()
-		_, err = f.Write(writeBuf)
-		bufferMutex.Unlock()
-		if err != nil {
-			r.logger.Error("error writing to file", "err", err)
-			return
-		}
-		writeBuf = writeBuf[:0]
-	}
+func (r *Ripper) stopping(_ error) error {
+	r.logger.Info("stopping")
 
-	closeAndCommit := func() {
-		if f == nil {
-			return
-		}
-		tempPath := f.Name()
-		// Flush any remaining buffered data (frame-sync buffer and write batch buffer)
-		if len(buffer) > 0 {
-			bufferMutex.Lock()
-			_, _ = f.Write(buffer)
-			bufferMutex.Unlock()
-		}
-		flushWriteBuf()
-		if syncErr := f.Sync(); syncErr != nil {
-			r.logger.Error("error syncing file", "err", syncErr)
-		}
-		if closeErr := f.Close(); closeErr != nil {
-			r.logger.Error("error closing file", "err", closeErr)
-		}
-		r.commitTempFile(tempPath, destPath)
-	}
+	// The stations were started with the running context and stop on their
+	// own once it is cancelled; wait for every supervisor to observe that.
+	r.wg.Wait()
 
-	for {
-		select {
-		case <-ctx.Done():
-			// Context canceled (new track started), stop writing and close file.
-			r.logger.Debug("context canceled, closing file")
-			closeAndCommit()
-			return
-		case b, ok := <-dataChan:
-			if !ok {
-				// Channel closed (shutdown); close file and exit
-				closeAndCommit()
-				return
-			}
-			if len(b) == 0 {
-				continue
-			}
+	// Every station has handed off its last track; commit them before
+	// returning.
+	r.fin.close()
 
-			if firstWrite {
-				// Find the first MP3 frame sync in the accumulated buffer + new data
-				buffer = append(buffer, b...)
-				framePos := findMP3FrameSync(buffer)
-				if framePos >= 0 {
-					// Found frame sync, write from that position
-					bufferMutex.Lock()
-					_, err = f.Write(buffer[framePos:])
-					if err != nil {
-						r.logger.Error("error writing to file", "err", err)
-						bufferMutex.Unlock()
-						return
-					}
-					bufferMutex.Unlock()
-					buffer = buffer[:0] // Clear buffer
-					firstWrite = false
-				} else if len(buffer) > 8192 {
-					// Buffer is getting large, write it anyway (might be valid MP3 without sync)
-					r.logger.Warn("no MP3 frame sync found in first 8KB, writing anyway")
-					bufferMutex.Lock()
-					_, err = f.Write(buffer)
-					if err != nil {
-						r.logger.Error("error writing to file", "err", err)
-						bufferMutex.Unlock()
-						return
-					}
-					bufferMutex.Unlock()
-					buffer = buffer[:0]
-					firstWrite = false
-				}
-				// Otherwise, keep buffering
-			} else {
-				// Normal write: batch in memory and only write when buffer is large enough
-				writeBuf = append(writeBuf, b...)
-				if len(writeBuf) >= writeBufSize {
-					flushWriteBuf()
-				}
-			}
-		}
-	}
+	return nil
 }
@@ -0,0 +1,55 @@
+package ripper
+
+import (
+	"os"
+)
+
+// spillFile is a FIFO of audio bytes on disk, used by the spill buffer
+// policy. Data is read back in the order it was written; once everything has
+// been read the file is truncated so it doesn't grow without bound.
+type spillFile struct {
+	f        *os.File
+	readOff  int64
+	writeOff int64
+}
+
+// newSpillFile creates a spill file in dir. The file is unlinked straight
+// away, so it is cleaned up even if the process dies.
+func newSpillFile(dir string) (*spillFile, error) {
+	f, err := os.CreateTemp(dir, "streamgo-spill-*")
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(f.Name())
+	return &spillFile{f: f}, nil
+}
+
+func (sf *spillFile) write(b []byte) error {
+	n, err := sf.f.WriteAt(b, sf.writeOff)
+	sf.writeOff += int64(n)
+	return err
+}
+
+// read fills b with the oldest unread data.
+func (sf *spillFile) read(b []byte) error {
+	n, err := sf.f.ReadAt(b, sf.readOff)
+	sf.readOff += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if sf.readOff == sf.writeOff {
+		sf.readOff, sf.writeOff = 0, 0
+		return sf.f.Truncate(0)
+	}
+	return nil
+}
+
+// pending returns the number of bytes waiting to be read.
+func (sf *spillFile) pending() int64 {
+	return sf.writeOff - sf.readOff
+}
+
+func (sf *spillFile) close() {
+	_ = sf.f.Close()
+}
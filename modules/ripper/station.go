@@ -0,0 +1,350 @@
+package ripper
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zachfi/streamgo/pkg/shoutcast"
+)
+
+// station records a single stream. Each station owns its own connection,
+// ChannelWriter and writer goroutine so that stations are independent of
+// each other. Recording is a pipeline: the copy goroutine only reads the
+// network into the ChannelWriter, the writer goroutine cuts the audio into
+// tracks, and the shared finalizer commits finished tracks. A station is a
+// service supervised by the Ripper; when it fails only that station is
+// affected.
+type station struct {
+	services.Service
+	cfg      StationConfig
+	logger   *slog.Logger
+	w        *ChannelWriter
+	mirrors  *mirrorSet
+	fin      *finalizer
+	copyWg   sync.WaitGroup // signals when the io.Copy goroutine has exited
+	writerWg sync.WaitGroup // signals when the file writer goroutine has exited
+}
+
+func newStation(cfg StationConfig, logger *slog.Logger, fin *finalizer) *station {
+	s := &station{
+		cfg:     cfg,
+		logger:  logger.With("station", cfg.Name),
+		w:       NewChannelWriter(cfg.Name, cfg.BufferSize, BufferPolicy(cfg.BufferPolicy), cfg.BufferSpillDir, logger),
+		mirrors: newMirrorSet(cfg.Name, cfg.URLs, cfg.ReconnectBackoff, cfg.ReconnectBackoffMax, *cfg.MinThroughput, cfg.MirrorRecheckInterval),
+		fin:     fin,
+	}
+
+	s.Service = services.NewBasicService(nil, s.running, s.stopping).WithName(cfg.Name)
+
+	return s
+}
+
+// running records the stream until ctx is cancelled. It returns an error,
+// failing the station, once MaxReconnects consecutive connection attempts
+// have failed.
+func (s *station) running(ctx context.Context) error {
+	cw := s.w
+
+	opts := s.cfg.streamOptions(s.logger)
+
+	fileName := ""
+	src := &source{} // the current connection
+
+	// startTrack starts a new file committed to name, less the extension, for
+	// the audio written from offset onwards.
+	startTrack := func(name, title, icyTitle string, offset int64, t time.Time) {
+		if name == fileName {
+			return
+		}
+		fileName = name
+
+		if err := cw.StartTrack(&track{name: name, title: title, icyTitle: icyTitle, offset: offset, time: t, src: src}); err != nil {
+			s.logger.Error("error starting track", "err", err)
+		}
+	}
+
+	// base is the writer offset at which the stream was connected; stream
+	// offsets are relative to it.
+	metadataEvent := func(stream *shoutcast.Stream, base int64) func(e shoutcast.MetadataEvent) {
+		return func(e shoutcast.MetadataEvent) {
+			s.logger.Info("now listening to", "title", e.Metadata.StreamTitle, "offset", e.Offset)
+			// The stream name and title come from the server, so both are
+			// sanitized to keep the recording inside Dir. HLS sources rarely
+			// send icy-name, and a track without a title is named like a
+			// time-split recording.
+			streamName := sanitizeFileName(cmp.Or(stream.Name, s.cfg.Name))
+			title := sanitizeFileName(e.Metadata.StreamTitle)
+			if title == "" {
+				title = sanitizeFileName(s.cfg.Name) + " " + e.Time.Format(splitTimeFormat)
+			}
+			startTrack(path.Join(s.cfg.Dir, streamName, title), e.Metadata.StreamTitle, e.Metadata.StreamTitle, base+e.Offset, e.Time)
+		}
+	}
+
+	// Streams without in-band metadata are split into fixed-length
+	// recordings named after the station and the start time.
+	splitCallback := func(t time.Time) {
+		title := sanitizeFileName(s.cfg.Name) + " " + t.Format(splitTimeFormat)
+		s.logger.Info("starting new recording", "title", title)
+		startTrack(path.Join(s.cfg.Dir, sanitizeFileName(s.cfg.Name), title), title, "", cw.Written(), t)
+	}
+
+	s.writerWg.Add(1)
+	go func() {
+		defer s.writerWg.Done()
+		s.writeLoop()
+	}()
+
+	metricStationUp.WithLabelValues(s.cfg.Name).Set(1)
+
+	errCh := make(chan error, 1)
+	s.copyWg.Add(1)
+	go func() {
+		defer s.copyWg.Done()
+		failures, permanent := 0, 0
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			m, wait := s.mirrors.pick()
+			if wait > 0 {
+				s.logger.Info("waiting before reconnecting", "url", m.url, "backoff", wait)
+				if sleepCtx(ctx, wait) != nil {
+					return
+				}
+			}
+
+			connCtx, cancel := context.WithCancel(ctx)
+			start := time.Now()
+			stream, err := shoutcast.OpenContext(connCtx, m.url, opts...)
+			if err != nil {
+				cancel()
+				if ctx.Err() != nil {
+					return
+				}
+				s.mirrors.failed(m, err)
+				failures++
+				if failures >= s.cfg.MaxReconnects {
+					errCh <- fmt.Errorf("giving up after %d failed connection attempts: %w", failures, err)
+					return
+				}
+				if shoutcast.IsPermanent(err) {
+					permanent++
+					if n := *s.cfg.MaxPermanentErrors; n > 0 && permanent >= n {
+						errCh <- fmt.Errorf("giving up after %d permanent errors: %w", permanent, err)
+						return
+					}
+				} else {
+					permanent = 0
+				}
+				s.logger.Error("error opening stream, reconnecting", "err", err, "url", m.url, "failures", failures, "permanent", shoutcast.IsPermanent(err))
+				continue
+			}
+			failures, permanent = 0, 0
+			s.mirrors.connected(m, time.Since(start), stream.Bitrate)
+			s.recordStreamInfo(stream)
+			src = &source{
+				contentType: stream.ContentType,
+				name:        cmp.Or(stream.Name, s.cfg.Name),
+				genre:       stream.Genre,
+				homepage:    stream.URL,
+				url:         m.url,
+				bitrate:     stream.Bitrate,
+				sampleRate:  stream.AudioInfo.SampleRate,
+				channels:    stream.AudioInfo.Channels,
+			}
+
+			var dst io.Writer = cw
+			if stream.HasMetadata() {
+				stream.MetadataEventFunc = metadataEvent(stream, cw.Written())
+			} else {
+				s.logger.Info("stream has no metadata, splitting recordings by time", "interval", s.cfg.SplitInterval)
+				dst = newSplitWriter(cw, s.cfg.SplitInterval, splitCallback)
+			}
+
+			// While on a fallback mirror, check whether a preferred one has
+			// recovered and, if so, drop this connection to move back.
+			var switched atomic.Bool
+			var helpers sync.WaitGroup
+			helpers.Add(2)
+			go func() {
+				defer helpers.Done()
+				s.recheckMirrors(connCtx, opts, func() {
+					switched.Store(true)
+					cancel()
+				})
+			}()
+
+			// The watchdog drops a connection that stopped delivering audio.
+			wd := newWatchdog(dst, s.cfg.IdleTimeout, stream.Bitrate, *s.cfg.MinThroughput, s.cfg.ThroughputWindow)
+			var stall string
+			go func() {
+				defer helpers.Done()
+				if stall = wd.run(connCtx); stall != "" {
+					cancel()
+				}
+			}()
+
+			// Cancelling ctx aborts the in-flight read, so io.Copy returns
+			// on shutdown without the stream having to be closed under it.
+			s.logger.Info("stream connected, copying", "url", m.url)
+			copyStart := time.Now()
+			n, copyErr := io.Copy(wd, stream)
+			_ = stream.Close()
+			cancel()
+			helpers.Wait()
+
+			elapsed := time.Since(copyStart)
+			s.mirrors.disconnected(m, n, elapsed)
+
+			if ctx.Err() != nil {
+				return
+			}
+			if switched.Load() {
+				s.logger.Info("switching back to preferred mirror")
+				continue
+			}
+			switch {
+			case stall != "":
+				metricStalls.WithLabelValues(s.cfg.Name, stall).Inc()
+				s.logger.Warn("stream stalled, reconnecting", "reason", stall, "url", m.url, "bitrate", stream.Bitrate)
+			case copyErr != nil && copyErr != io.EOF:
+				s.logger.Warn("stream disconnected, reconnecting", "err", copyErr, "url", m.url)
+			}
+			// A dropped connection counts against the mirror so that the
+			// next attempt goes to another one straight away.
+			s.mirrors.failed(m, nil)
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errCh:
+		return err
+	}
+}
+
+// recordStreamInfo logs and exports what the server says about the audio.
+func (s *station) recordStreamInfo(stream *shoutcast.Stream) {
+	info := stream.AudioInfo
+	s.logger.Info("stream info",
+		"content_type", stream.ContentType,
+		"bitrate", stream.Bitrate,
+		"samplerate", info.SampleRate,
+		"channels", info.Channels,
+		"server", stream.Server,
+	)
+
+	metricStreamInfo.DeletePartialMatch(prometheus.Labels{"station": s.cfg.Name})
+	metricStreamInfo.WithLabelValues(
+		s.cfg.Name,
+		stream.ContentType,
+		strconv.Itoa(stream.Bitrate),
+		strconv.Itoa(info.SampleRate),
+		strconv.Itoa(info.Channels),
+	).Set(1)
+}
+
+// recheckMirrors probes the mirrors preferred over the active one every
+// MirrorRecheckInterval until ctx is done. It calls switchBack once one of
+// them answers with audio.
+func (s *station) recheckMirrors(ctx context.Context, opts []shoutcast.Option, switchBack func()) {
+	t := time.NewTicker(s.cfg.MirrorRecheckInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		for _, m := range s.mirrors.better() {
+			if s.probeMirror(ctx, m, opts) {
+				s.logger.Info("preferred mirror recovered", "url", m.url)
+				switchBack()
+				return
+			}
+		}
+	}
+}
+
+// probeMirror connects to m and reads a little audio to check that it
+// works, recording the result.
+func (s *station) probeMirror(ctx context.Context, m *mirror, opts []shoutcast.Option) bool {
+	ctx, cancel := context.WithTimeout(ctx, mirrorProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	stream, err := shoutcast.OpenContext(ctx, m.url, opts...)
+	if err == nil {
+		_, err = io.ReadFull(stream, make([]byte, 4096))
+		_ = stream.Close()
+	}
+	if err != nil {
+		if ctx.Err() == nil || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			s.logger.Debug("mirror still unavailable", "url", m.url, "err", err)
+			s.mirrors.failed(m, err)
+		}
+		return false
+	}
+	s.mirrors.recovered(m, time.Since(start))
+	return true
+}
+
+// stopping waits for the copy goroutine, which exits once the running
+// context is cancelled, closes the writer and waits for the last file to be
+// handed to the finalizer.
+func (s *station) stopping(_ error) error {
+	defer metricStationUp.WithLabelValues(s.cfg.Name).Set(0)
+
+	s.copyWg.Wait()
+	err := s.w.Close()
+	s.writerWg.Wait()
+
+	return err
+}
+
+// sleepCtx sleeps for d or until ctx is done. Returns ctx.Err() if context was cancelled.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// mirrorProbeTimeout bounds a health check of a preferred mirror.
+const mirrorProbeTimeout = 15 * time.Second
+
+// splitTimeFormat is the timestamp layout used to name time-split recordings.
+const splitTimeFormat = "2006-01-02T15-04-05"
+
+// sanitizeFileName replaces characters that would change the meaning of a
+// path so that name can be used as a single path element. Surrounding space
+// is trimmed, and "." and ".." are replaced, as they name directories.
+func sanitizeFileName(name string) string {
+	name = strings.TrimSpace(strings.NewReplacer("/", "_", "\\", "_", ":", "_", "\x00", "").Replace(name))
+	if name == "." || name == ".." {
+		return strings.Repeat("_", len(name))
+	}
+	return name
+}
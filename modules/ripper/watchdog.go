@@ -0,0 +1,94 @@
+package ripper
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Reasons a watchdog trips, used as the metric label.
+const (
+	stallIdle = "idle"
+	stallSlow = "slow"
+)
+
+// watchdog detects a connection that has stopped delivering audio, or
+// delivers it much slower than the stream's bitrate. The client sets no
+// read timeout so that recordings can run for days; without the watchdog a
+// connection that silently dies would block io.Copy forever.
+type watchdog struct {
+	w io.Writer
+
+	idleTimeout time.Duration
+	minRate     float64 // bytes per second; 0 disables the throughput check
+	window      time.Duration
+
+	lastWrite atomic.Int64 // unix nanoseconds
+	total     atomic.Int64 // audio bytes written
+	writing   atomic.Bool  // a write is blocked on the buffer, not the network
+}
+
+// newWatchdog wraps w. bitrate is the stream's advertised bitrate in kbps;
+// the throughput check is skipped when it is unknown or minRatio is 0.
+func newWatchdog(w io.Writer, idleTimeout time.Duration, bitrate int, minRatio float64, window time.Duration) *watchdog {
+	wd := &watchdog{
+		w:           w,
+		idleTimeout: idleTimeout,
+		minRate:     float64(bitrate) * 1000 / 8 * minRatio,
+		window:      window,
+	}
+	wd.lastWrite.Store(time.Now().UnixNano())
+	return wd
+}
+
+func (wd *watchdog) Write(p []byte) (int, error) {
+	wd.writing.Store(true)
+	defer func() {
+		wd.lastWrite.Store(time.Now().UnixNano())
+		wd.writing.Store(false)
+	}()
+
+	wd.total.Add(int64(len(p)))
+	return wd.w.Write(p)
+}
+
+// run checks the connection until ctx is done. It returns the reason it
+// tripped, or "" if ctx ended first.
+func (wd *watchdog) run(ctx context.Context) string {
+	tick := time.Second
+	if wd.idleTimeout > 0 {
+		tick = min(tick, wd.idleTimeout/4)
+	}
+	t := time.NewTicker(tick)
+	defer t.Stop()
+
+	windowStart, windowBytes := time.Now(), int64(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return ""
+		case now := <-t.C:
+			if wd.writing.Load() {
+				// A full buffer with the block policy holds up the
+				// copy; that isn't the connection's fault.
+				windowStart, windowBytes = now, wd.total.Load()
+				continue
+			}
+			if wd.idleTimeout > 0 && now.Sub(time.Unix(0, wd.lastWrite.Load())) > wd.idleTimeout {
+				return stallIdle
+			}
+
+			if wd.minRate <= 0 || wd.window <= 0 {
+				continue
+			}
+			if elapsed := now.Sub(windowStart); elapsed >= wd.window {
+				total := wd.total.Load()
+				if rate := float64(total-windowBytes) / elapsed.Seconds(); rate < wd.minRate {
+					return stallSlow
+				}
+				windowStart, windowBytes = now, total
+			}
+		}
+	}
+}
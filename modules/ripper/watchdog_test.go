@@ -0,0 +1,127 @@
+package ripper
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// blockingWriter blocks each Write until release is closed, like a full
+// buffer with the block policy.
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func TestWatchdog(t *testing.T) {
+	const (
+		idleTimeout = 200 * time.Millisecond // checked every 50ms
+		window      = 200 * time.Millisecond
+		bitrate     = 128        // 16000 bytes per second
+		minRatio    = 0.5        // 8000 bytes per second
+		runFor      = 4 * window // how long a healthy connection runs
+		writeEvery  = 10 * time.Millisecond
+	)
+
+	// feed writes n bytes every writeEvery until ctx is done.
+	feed := func(n int) func(ctx context.Context, wd *watchdog) {
+		return func(ctx context.Context, wd *watchdog) {
+			t := time.NewTicker(writeEvery)
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					wd.Write(make([]byte, n))
+				}
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		w        io.Writer
+		bitrate  int
+		minRatio float64
+		feed     func(ctx context.Context, wd *watchdog)
+		want     string
+	}{
+		{
+			name:     "healthy",
+			w:        io.Discard,
+			bitrate:  bitrate,
+			minRatio: minRatio,
+			feed:     feed(400), // 40000 bytes per second
+		},
+		{
+			name:     "idle",
+			w:        io.Discard,
+			bitrate:  bitrate,
+			minRatio: minRatio,
+			feed:     func(context.Context, *watchdog) {},
+			want:     stallIdle,
+		},
+		{
+			name:     "slow",
+			w:        io.Discard,
+			bitrate:  bitrate,
+			minRatio: minRatio,
+			feed:     feed(10), // 1000 bytes per second
+			want:     stallSlow,
+		},
+		{
+			name:     "slow with unknown bitrate",
+			w:        io.Discard,
+			feed:     feed(10),
+			minRatio: minRatio,
+		},
+		{
+			name:    "slow with the throughput check disabled",
+			w:       io.Discard,
+			bitrate: bitrate,
+			feed:    feed(10),
+		},
+		{
+			name:     "writer blocked on the buffer",
+			w:        &blockingWriter{release: make(chan struct{})},
+			bitrate:  bitrate,
+			minRatio: minRatio,
+			feed: func(_ context.Context, wd *watchdog) {
+				wd.Write(make([]byte, 1))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			wd := newWatchdog(tt.w, idleTimeout, tt.bitrate, tt.minRatio, window)
+
+			ctx, cancel := context.WithTimeout(context.Background(), runFor)
+			defer cancel()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				tt.feed(ctx, wd)
+			}()
+
+			got := wd.run(ctx)
+			cancel()
+			if bw, ok := tt.w.(*blockingWriter); ok {
+				close(bw.release)
+			}
+			<-done
+
+			if got != tt.want {
+				t.Errorf("run() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,20 +1,150 @@
 package ripper
 
 import (
+	"bytes"
 	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zachfi/streamgo/pkg/id3"
+	"github.com/zachfi/streamgo/pkg/mpegaudio"
+)
+
+// chunkSize matches the buffer io.Copy uses, so a write normally fits in a
+// single chunk.
+const chunkSize = 32 * 1024
+
+// track describes a recording that starts at offset bytes into the audio
+// written to a ChannelWriter.
+type track struct {
+	name     string // destination path without the extension, which depends on the codec
+	title    string
+	icyTitle string // the StreamTitle it was named after; empty for split recordings
+	offset   int64
+	time     time.Time
+	src      *source
+}
+
+// source describes the connection a track was recorded from.
+type source struct {
+	contentType string // as announced by the server, for codec detection
+	name        string // icy-name, or the station's name
+	genre       string
+	homepage    string // icy-url
+	url         string // the stream URL connected to
+
+	// The audio parameters announced by the server; 0 if unknown.
+	bitrate    int // kbps
+	sampleRate int // Hz
+	channels   int
+}
+
+// chunk is a pooled piece of stream data handed from the stream reader to
+// the file writer. The receiver must release it once the data is copied. A
+// chunk with a track set carries no data and marks the start of a new track.
+type chunk struct {
+	b     []byte
+	track *track
+
+	// lost counts audio bytes dropped from the buffer immediately before
+	// this chunk.
+	lost int64
+
+	// spilled is the length of the data when it is waiting in the spill
+	// file rather than in b.
+	spilled int
+}
+
+var chunkPool = sync.Pool{
+	New: func() any {
+		return &chunk{b: make([]byte, 0, chunkSize)}
+	},
+}
+
+func newChunk(p []byte) *chunk {
+	c := chunkPool.Get().(*chunk)
+	c.b = append(c.b[:0], p...)
+	return c
+}
+
+func (c *chunk) release() {
+	c.track = nil
+	c.lost = 0
+	c.spilled = 0
+	chunkPool.Put(c)
+}
+
+// BufferPolicy decides what a ChannelWriter does with new audio when its
+// buffer is full.
+type BufferPolicy string
+
+const (
+	// BufferBlock makes Write wait for the file writer to catch up. Nothing
+	// is lost, but the stream isn't read while waiting.
+	BufferBlock BufferPolicy = "block"
+
+	// BufferDropOldest discards the oldest buffered audio to make room. The
+	// recordings it belonged to are marked as damaged.
+	BufferDropOldest BufferPolicy = "drop-oldest"
+
+	// BufferSpill writes the overflow to a temporary file and reads it back
+	// once the file writer catches up.
+	BufferSpill BufferPolicy = "spill"
 )
 
+func (p BufferPolicy) valid() bool {
+	switch p {
+	case BufferBlock, BufferDropOldest, BufferSpill:
+		return true
+	}
+	return false
+}
+
+// ChannelWriter buffers stream audio, and the track markers between it, for
+// the station's file writer. The buffer is bounded by the number of audio
+// bytes held in memory; what happens when it is full depends on the policy.
 type ChannelWriter struct {
 	sync.Mutex
-	dataChan chan []byte
+	cond     *sync.Cond // signalled whenever the queue changes
+	queue    []*chunk
+	buffered int // audio bytes held in memory
+	limit    int
+	policy   BufferPolicy
+	spill    *spillFile
+	lost     int64 // bytes dropped after the last queued chunk
 	closed   bool
+	written  int64 // audio bytes written so far
+
+	logger   *slog.Logger
+	fill     prometheus.Gauge
+	spilled  prometheus.Gauge
+	dropped  prometheus.Counter
+	spillDir string
 }
 
-func NewChannelWriter() *ChannelWriter {
-	return &ChannelWriter{
-		dataChan: make(chan []byte, 10240), // Buffer size can be adjusted as needed
+// NewChannelWriter returns a ChannelWriter holding at most limit bytes of
+// audio in memory. name labels the buffer metrics. Spill files are created
+// in spillDir, or the system temp directory when it is empty.
+func NewChannelWriter(name string, limit int, policy BufferPolicy, spillDir string, logger *slog.Logger) *ChannelWriter {
+	cw := &ChannelWriter{
+		limit:    max(limit, chunkSize),
+		policy:   policy,
+		spillDir: spillDir,
+		logger:   logger,
+		fill:     metricBufferBytes.WithLabelValues(name),
+		spilled:  metricBufferSpilledBytes.WithLabelValues(name),
+		dropped:  metricBufferDroppedBytes.WithLabelValues(name),
 	}
+	cw.cond = sync.NewCond(&cw.Mutex)
+	cw.fill.Set(0)
+	cw.spilled.Set(0)
+	return cw
 }
 
 func (cw *ChannelWriter) Write(p []byte) (n int, err error) {
@@ -25,22 +155,624 @@ func (cw *ChannelWriter) Write(p []byte) (n int, err error) {
 		return 0, io.ErrClosedPipe
 	}
 
-	// Copy the data to avoid issues if the caller reuses the buffer
-	data := make([]byte, len(p))
-	copy(data, p)
-	cw.dataChan <- data
+	// Copy the data into pooled chunks since the caller reuses the buffer.
+	// Network reads are often much smaller than a chunk, so they are added
+	// to the last queued chunk while it has room rather than each pinning a
+	// chunk of their own.
+	for len(p) > 0 {
+		room := chunkSize
+		if c := cw.tail(); c != nil {
+			room = cap(c.b) - len(c.b)
+		}
+		b := p[:min(len(p), room)]
+		p = p[len(b):]
+
+		if cw.buffered+len(b) > cw.limit {
+			switch cw.policy {
+			case BufferDropOldest:
+				cw.dropOldest(cw.buffered + len(b) - cw.limit)
+			case BufferSpill:
+				if cw.spillChunk(b) {
+					n += len(b)
+					continue
+				}
+				// Spilling failed; the data is lost either way.
+				cw.drop(int64(len(b)))
+				n += len(b)
+				continue
+			default:
+				for cw.buffered > 0 && cw.buffered+len(b) > cw.limit && !cw.closed {
+					cw.cond.Wait()
+				}
+				if cw.closed {
+					return n, io.ErrClosedPipe
+				}
+			}
+		}
+
+		// The tail may have been taken or dropped while waiting.
+		if c := cw.tail(); c != nil && cap(c.b)-len(c.b) >= len(b) {
+			c.b = append(c.b, b...)
+		} else {
+			cw.push(newChunk(b))
+		}
+		cw.buffered += len(b)
+		n += len(b)
+	}
+	cw.written += int64(n)
+	cw.fill.Set(float64(cw.buffered))
+
+	return n, nil
+}
+
+// tail returns the last queued chunk if audio can be appended to it: it
+// holds audio in memory, has room left and no audio was dropped after it.
+// The caller must hold the lock.
+func (cw *ChannelWriter) tail() *chunk {
+	if len(cw.queue) == 0 || cw.lost > 0 {
+		return nil
+	}
+	c := cw.queue[len(cw.queue)-1]
+	if c.track != nil || c.spilled > 0 || len(c.b) == cap(c.b) {
+		return nil
+	}
+	return c
+}
+
+// push queues c after any data that was dropped since the previous chunk.
+// The caller must hold the lock.
+func (cw *ChannelWriter) push(c *chunk) {
+	c.lost, cw.lost = cw.lost, 0
+	cw.queue = append(cw.queue, c)
+	cw.cond.Broadcast()
+}
 
-	return len(p), nil
+// drop records n bytes of audio lost after the last queued chunk. The caller
+// must hold the lock.
+func (cw *ChannelWriter) drop(n int64) {
+	cw.lost += n
+	cw.dropped.Add(float64(n))
 }
 
+// dropOldest discards buffered audio, oldest first, until at least n bytes
+// are free. Track markers are kept so that later audio still lands in the
+// right file. The caller must hold the lock.
+func (cw *ChannelWriter) dropOldest(n int) {
+	for i := 0; i < len(cw.queue) && n > 0; {
+		c := cw.queue[i]
+		if c.track != nil || c.spilled > 0 || len(c.b) == 0 {
+			i++
+			continue
+		}
+
+		lost := c.lost + int64(len(c.b))
+		cw.queue = append(cw.queue[:i], cw.queue[i+1:]...)
+		if i < len(cw.queue) {
+			cw.queue[i].lost += lost
+		} else {
+			cw.lost += lost
+		}
+		cw.buffered -= len(c.b)
+		cw.dropped.Add(float64(len(c.b)))
+		n -= len(c.b)
+		c.release()
+	}
+}
+
+// spillChunk appends b to the spill file and queues a placeholder for it.
+// The caller must hold the lock.
+func (cw *ChannelWriter) spillChunk(b []byte) bool {
+	if cw.spill == nil {
+		sf, err := newSpillFile(cw.spillDir)
+		if err != nil {
+			cw.logger.Error("error creating buffer spill file, dropping audio", "err", err)
+			return false
+		}
+		cw.spill = sf
+	}
+	if err := cw.spill.write(b); err != nil {
+		cw.logger.Error("error writing buffer spill file, dropping audio", "err", err)
+		return false
+	}
+
+	c := chunkPool.Get().(*chunk)
+	c.b = c.b[:0]
+	c.spilled = len(b)
+	cw.push(c)
+	cw.spilled.Set(float64(cw.spill.pending()))
+	return true
+}
+
+// next returns the oldest queued chunk, waiting for one if necessary. It
+// returns false once the writer is closed and the queue is drained.
+func (cw *ChannelWriter) next() (*chunk, bool) {
+	cw.Lock()
+	defer cw.Unlock()
+
+	for len(cw.queue) == 0 && !cw.closed {
+		cw.cond.Wait()
+	}
+	if len(cw.queue) == 0 {
+		if cw.spill != nil {
+			cw.spill.close()
+			cw.spill = nil
+		}
+		return nil, false
+	}
+
+	c := cw.queue[0]
+	cw.queue[0] = nil
+	cw.queue = cw.queue[1:]
+
+	if c.spilled > 0 {
+		c.b = c.b[:c.spilled]
+		if err := cw.spill.read(c.b); err != nil {
+			// The audio is gone; account for it like a drop.
+			cw.logger.Error("error reading buffer spill file", "err", err)
+			c.lost += int64(c.spilled)
+			cw.dropped.Add(float64(c.spilled))
+			c.b = c.b[:0]
+		}
+		c.spilled = 0
+		cw.spilled.Set(float64(cw.spill.pending()))
+	} else {
+		cw.buffered -= len(c.b)
+		cw.fill.Set(float64(cw.buffered))
+	}
+	cw.cond.Broadcast()
+
+	return c, true
+}
+
+// Written returns the number of audio bytes written so far.
+func (cw *ChannelWriter) Written() int64 {
+	cw.Lock()
+	defer cw.Unlock()
+	return cw.written
+}
+
+// StartTrack queues a marker so that audio written after it goes to a new
+// file. t.offset is where the caller expects the track to start; writing to
+// cw is in order, so it should equal Written.
+func (cw *ChannelWriter) StartTrack(t *track) error {
+	cw.Lock()
+	defer cw.Unlock()
+
+	if cw.closed {
+		return io.ErrClosedPipe
+	}
+
+	c := chunkPool.Get().(*chunk)
+	c.b = c.b[:0]
+	c.track = t
+	cw.push(c)
+
+	return nil
+}
+
+// Close stops further writes. Audio already buffered is still handed to
+// the file writer.
 func (cw *ChannelWriter) Close() error {
 	cw.Lock()
 	defer cw.Unlock()
 
 	if !cw.closed {
-		close(cw.dataChan)
+		if cw.lost > 0 {
+			// Carry the loss to the file writer on an empty chunk.
+			c := chunkPool.Get().(*chunk)
+			c.b = c.b[:0]
+			cw.push(c)
+		}
 		cw.closed = true
+		cw.cond.Broadcast()
 	}
 
 	return nil
 }
+
+// splitWriter passes writes through to w and calls split whenever interval
+// has elapsed since the previous split. The first write triggers a split so
+// that a file is open before any data arrives.
+type splitWriter struct {
+	w        io.Writer
+	interval time.Duration
+	split    func(t time.Time)
+	next     time.Time
+}
+
+func newSplitWriter(w io.Writer, interval time.Duration, split func(t time.Time)) *splitWriter {
+	return &splitWriter{
+		w:        w,
+		interval: interval,
+		split:    split,
+	}
+}
+
+func (sw *splitWriter) Write(p []byte) (int, error) {
+	if now := time.Now(); !now.Before(sw.next) {
+		sw.split(now)
+		sw.next = now.Add(sw.interval)
+	}
+	return sw.w.Write(p)
+}
+
+// commitTempFile renames tempPath to destPath only if dest doesn't exist or
+// the temp file is larger (so a previous crash doesn't overwrite a good recording).
+func (s *station) commitTempFile(tempPath, destPath string) {
+	tempInfo, err := os.Stat(tempPath)
+	if err != nil {
+		s.logger.Error("error stating temp file", "err", err, "path", tempPath)
+		_ = os.Remove(tempPath)
+		return
+	}
+	destInfo, err := os.Stat(destPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.logger.Error("error stating dest file", "err", err, "path", destPath)
+			_ = os.Remove(tempPath)
+			return
+		}
+		// Dest doesn't exist; use the temp file.
+		if err := os.Rename(tempPath, destPath); err != nil {
+			s.logger.Error("error renaming temp to dest", "err", err, "temp", tempPath, "dest", destPath)
+			_ = os.Remove(tempPath)
+			return
+		}
+		s.logger.Debug("saved new recording", "path", destPath)
+		return
+	}
+	if tempInfo.Size() > destInfo.Size() {
+		if err := os.Rename(tempPath, destPath); err != nil {
+			s.logger.Error("error renaming temp to dest", "err", err, "temp", tempPath, "dest", destPath)
+			_ = os.Remove(tempPath)
+			return
+		}
+		s.logger.Debug("overwrote with longer recording", "path", destPath, "size", tempInfo.Size())
+	} else {
+		_ = os.Remove(tempPath)
+		s.logger.Debug("discarded shorter recording", "path", destPath, "temp_size", tempInfo.Size(), "existing_size", destInfo.Size())
+	}
+}
+
+// minWriteBufSize and maxWriteBufSize clamp the configured write buffer to avoid
+// tiny writes (no benefit) or very large buffers (memory and latency).
+const (
+	minWriteBufSize = 32 * 1024       // 32 KiB
+	maxWriteBufSize = 4 * 1024 * 1024 // 4 MiB
+)
+
+// maxStreamHeaderSize bounds how much is buffered while waiting for the end
+// of a stream's codec headers. Vorbis comments can carry cover art, so this
+// is generous.
+const maxStreamHeaderSize = 1024 * 1024
+
+// streamHeader holds the codec headers from the last file that began at the
+// start of a stream. Ogg and FLAC can't be decoded without them, so they are
+// put in front of files that start mid-stream. Only writeLoop touches it.
+type streamHeader struct {
+	codec *codec
+	b     []byte
+}
+
+// writeLoop consumes the station's buffer until it is closed. Track
+// markers arrive in order with the audio, so each file starts exactly at the
+// offset where the metadata changed, or rather at the first frame boundary
+// after it: a frame that straddles the change is carried into the next file
+// whole. Finished files are handed to the finalizer so that committing one
+// never holds up the next.
+func (s *station) writeLoop() {
+	var fw *fileWriter
+	var offset int64
+	hdr := &streamHeader{}
+
+	// finish hands fw to the finalizer, first creating its file if the
+	// track was too short for the codec to be found. It returns the partial
+	// frame the track ended with.
+	finish := func(fw *fileWriter) []byte {
+		if fw.f == nil && len(fw.buffer) > 0 {
+			fw.open(true)
+		}
+		carry := fw.partial
+		fw.partial = nil
+		s.fin.submit(fw)
+		return carry
+	}
+
+	for {
+		c, ok := s.w.next()
+		if !ok {
+			break
+		}
+
+		// Dropped audio precedes c, so it belongs to the current file even
+		// when c starts a new track.
+		if c.lost > 0 {
+			offset += c.lost
+			if fw != nil {
+				fw.lost += c.lost
+			}
+		}
+
+		if t := c.track; t != nil {
+			if t.offset != offset {
+				s.logger.Warn("track marker out of step with audio", "marker_offset", t.offset, "offset", offset)
+			}
+			var carry []byte
+			if fw != nil {
+				carry = finish(fw)
+			}
+			fw = s.newFileWriter(t, hdr)
+			fw.buffer = append(fw.buffer, carry...)
+		} else {
+			offset += int64(len(c.b))
+			if fw != nil && !fw.write(c.b) {
+				// Writing failed; drop the rest of this track.
+				finish(fw)
+				fw = nil
+			}
+		}
+		c.release()
+	}
+
+	// Buffer closed (shutdown); hand off the last file and exit
+	if fw != nil {
+		finish(fw)
+	}
+}
+
+// fileWriter writes one track to a temp file that is committed to its
+// destination when the track ends. The file is only created once the codec
+// is known, since that decides its extension and whether it gets an ID3 tag.
+type fileWriter struct {
+	s        *station
+	t        *track
+	hdr      *streamHeader
+	f        *os.File // nil until the codec is known
+	codec    *codec
+	destPath string
+	buffer   []byte // Buffer to accumulate data until we find frame sync
+	writeBuf []byte // Batch writes to reduce disk I/O
+	lost     int64  // audio bytes dropped from the buffer during this track
+
+	// For codecs that are written in whole frames: the start of a frame
+	// still waiting for the rest of it, which moves to the next track if
+	// this one ends first, and what has been written so far.
+	partial  []byte
+	frames   int
+	duration time.Duration
+	skipped  int // bytes between frames that weren't a frame
+
+	xing    *xingWriter // MP3 only
+	tag     *id3.Tag    // MP3 and AAC only
+	tagSize int
+}
+
+// newFileWriter prepares a file for t. hdr is the writer loop's record of
+// the stream's codec headers.
+func (s *station) newFileWriter(t *track, hdr *streamHeader) *fileWriter {
+	if err := os.MkdirAll(path.Dir(t.name), os.ModePerm); err != nil {
+		s.logger.Error("error creating stream directory", "err", err)
+	}
+
+	writeBufSize := s.cfg.WriteBufferSize
+	if writeBufSize < minWriteBufSize {
+		writeBufSize = minWriteBufSize
+	}
+	if writeBufSize > maxWriteBufSize {
+		writeBufSize = maxWriteBufSize
+	}
+
+	return &fileWriter{
+		s:        s,
+		t:        t,
+		hdr:      hdr,
+		buffer:   make([]byte, 0, 4096),
+		writeBuf: make([]byte, 0, writeBufSize),
+	}
+}
+
+// open detects the codec from the buffered audio and creates the temp file,
+// starting it at the first frame or page. Until the codec is found it keeps
+// buffering, unless force is set or more than sniffLimit has arrived, in
+// which case the content type's codec (or MP3) is assumed. It returns false
+// if the file can't be created; the track's audio is then dropped.
+func (fw *fileWriter) open(force bool) bool {
+	contentType := fw.t.src.contentType
+	c, pos := detectCodec(contentType, fw.buffer)
+	if c == nil {
+		if !force && len(fw.buffer) <= sniffLimit {
+			return true
+		}
+		if c, pos = codecForContentType(contentType), 0; c == nil {
+			c = codecMP3
+		}
+		fw.s.logger.Warn("no frame sync found, writing anyway", "codec", c.name, "content_type", contentType, "size", len(fw.buffer))
+	}
+	data := fw.buffer[pos:]
+
+	// A file that starts with the stream's headers refreshes the saved
+	// copy; one that starts mid-stream gets the saved copy put in front.
+	var prefix, header []byte
+	if c.streamHeader != nil {
+		switch n := c.streamHeader(data); {
+		case n < 0 && !force && len(data) <= maxStreamHeaderSize:
+			return true
+		case n > 0:
+			fw.hdr.codec, fw.hdr.b = c, bytes.Clone(data[:n])
+			header = fw.hdr.b
+		case fw.hdr.codec == c:
+			prefix = fw.hdr.b
+			header = prefix
+		default:
+			fw.s.logger.Warn("no codec headers for recording, it may not play", "codec", c.name, "path", fw.t.name)
+		}
+	}
+
+	ext := c.ext
+	if c == codecOgg && isOpus(header) {
+		ext = ".opus"
+	}
+
+	f, err := os.CreateTemp(path.Dir(fw.t.name), "*"+ext+".tmp")
+	if err != nil {
+		fw.s.logger.Error("error creating temp file", "err", err)
+		fw.buffer = nil
+		return false
+	}
+	fw.f, fw.codec, fw.destPath = f, c, fw.t.name+ext
+	fw.s.logger.Debug("starting new file", "path", fw.destPath, "codec", c.name)
+
+	if c.id3 {
+		if err := fw.writeTag(); err != nil {
+			fw.s.logger.Error("error writing ID3 tag", "err", err)
+		}
+	}
+	if _, err := f.Write(prefix); err != nil {
+		fw.s.logger.Error("error writing to file", "err", err)
+		fw.buffer = nil
+		return false
+	}
+	if c == codecMP3 {
+		if h, ok := mpegaudio.ParseHeader(data); ok {
+			var err error
+			if fw.xing, err = newXingWriter(f, h); err != nil {
+				fw.s.logger.Error("error writing Xing header", "err", err)
+			}
+		}
+	}
+	fw.buffer = nil
+	return fw.writeAudio(data)
+}
+
+// write buffers b for writing. Both buffers copy the data, so the caller may
+// reuse b afterwards. It returns false if writing failed.
+func (fw *fileWriter) write(b []byte) bool {
+	if len(b) == 0 {
+		return true
+	}
+
+	if fw.f == nil {
+		fw.buffer = append(fw.buffer, b...)
+		return fw.open(false)
+	}
+	return fw.writeAudio(b)
+}
+
+func (fw *fileWriter) writeAudio(b []byte) bool {
+	if fw.codec.frame != nil {
+		fw.appendFrames(b)
+	} else {
+		fw.writeBuf = append(fw.writeBuf, b...)
+	}
+
+	// Batch in memory and only write when buffer is large enough
+	if len(fw.writeBuf) >= cap(fw.writeBuf) {
+		return fw.flush()
+	}
+	return true
+}
+
+// appendFrames adds the whole frames in the held back partial frame and b
+// to the write buffer and holds back what is left. Bytes between frames
+// that don't parse as one are skipped up to the next frame sync.
+func (fw *fileWriter) appendFrames(b []byte) {
+	buf := b
+	if len(fw.partial) > 0 {
+		buf = append(fw.partial, b...)
+	}
+
+	off, start := 0, 0
+	for off < len(buf) {
+		n, samples, rate := fw.codec.frame(buf[off:])
+		if n < 0 || off+n > len(buf) {
+			break
+		}
+		if n == 0 {
+			fw.writeBuf = append(fw.writeBuf, buf[start:off]...)
+			next := fw.codec.sync(buf[off+1:])
+			if next < 0 {
+				// The next frame may be in what is left, just too close to
+				// the end for the frames after it to be checked. Hold back
+				// up to sniffLimit bytes to search again with more data.
+				skip := max(len(buf)-off-sniffLimit, 1)
+				fw.skipped += skip
+				off += skip
+				start = off
+				break
+			}
+			fw.skipped += next + 1
+			off += next + 1
+			start = off
+			continue
+		}
+		fw.frames++
+		if fw.xing != nil {
+			fw.xing.add(buf[off : off+n])
+		}
+		if rate > 0 {
+			fw.duration += time.Duration(samples) * time.Second / time.Duration(rate)
+		}
+		off += n
+	}
+
+	fw.writeBuf = append(fw.writeBuf, buf[start:off]...)
+	fw.partial = append(fw.partial[:0], buf[off:]...)
+}
+
+func (fw *fileWriter) flush() bool {
+	if len(fw.writeBuf) == 0 {
+		return true
+	}
+	if _, err := fw.f.Write(fw.writeBuf); err != nil {
+		fw.s.logger.Error("error writing to file", "err", err)
+		return false
+	}
+	fw.writeBuf = fw.writeBuf[:0]
+	return true
+}
+
+// commit runs on a finalizer worker. It flushes the write batch buffer,
+// closes the file and moves it into place. A track that never got a file,
+// because it had no audio or the file couldn't be created, is skipped.
+func (fw *fileWriter) commit() {
+	if fw.f == nil {
+		return
+	}
+	tempPath := fw.f.Name()
+	fw.flush()
+	if fw.codec.frame != nil {
+		fw.s.logger.Debug("recording ends on a frame boundary",
+			"path", fw.destPath, "frames", fw.frames, "duration", fw.duration, "skipped", fw.skipped)
+	}
+	if fw.xing != nil {
+		if err := fw.xing.commit(fw.f); err != nil {
+			fw.s.logger.Error("error writing Xing header", "err", err)
+		}
+	}
+	if fw.tag != nil {
+		if err := fw.commitTag(); err != nil {
+			fw.s.logger.Error("error writing ID3 tag", "err", err)
+		}
+	}
+	if syncErr := fw.f.Sync(); syncErr != nil {
+		fw.s.logger.Error("error syncing file", "err", syncErr)
+	}
+	if closeErr := fw.f.Close(); closeErr != nil {
+		fw.s.logger.Error("error closing file", "err", closeErr)
+	}
+
+	destPath := fw.destPath
+	if fw.lost > 0 {
+		destPath = damagedPath(destPath)
+		fw.s.logger.Warn("recording lost audio, marking as damaged", "path", destPath, "lost_bytes", fw.lost)
+		metricDamagedRecordings.WithLabelValues(fw.s.cfg.Name).Inc()
+	}
+	fw.s.commitTempFile(tempPath, destPath)
+}
+
+// damagedPath returns the name for a recording with gaps in it, e.g.
+// "Title.damaged.mp3", so it doesn't replace or pass for a clean one.
+func damagedPath(p string) string {
+	ext := path.Ext(p)
+	return strings.TrimSuffix(p, ext) + ".damaged" + ext
+}
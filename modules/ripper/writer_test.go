@@ -0,0 +1,299 @@
+package ripper
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/zachfi/streamgo/pkg/id3"
+	"github.com/zachfi/streamgo/pkg/mpegaudio"
+)
+
+// TestChannelWriterSmallWrites checks that small writes share chunks, so the
+// byte limit bounds memory, without moving audio across a track marker.
+func TestChannelWriterSmallWrites(t *testing.T) {
+	cw := NewChannelWriter("test", 1<<20, BufferBlock, "", slog.New(slog.DiscardHandler))
+
+	var want bytes.Buffer
+	write := func(n int) {
+		p := bytes.Repeat([]byte{byte(want.Len())}, n)
+		want.Write(p)
+		if _, err := cw.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 100 {
+		write(1000)
+	}
+	marker := int64(want.Len())
+	if err := cw.StartTrack(&track{offset: marker}); err != nil {
+		t.Fatal(err)
+	}
+	for range 100 {
+		write(1000)
+	}
+	cw.Close()
+
+	var got bytes.Buffer
+	chunks := 0
+	for {
+		c, ok := cw.next()
+		if !ok {
+			break
+		}
+		if c.track != nil && int64(got.Len()) != c.track.offset {
+			t.Errorf("track marker after %d bytes, want %d", got.Len(), c.track.offset)
+		}
+		if len(c.b) > 0 {
+			chunks++
+		}
+		got.Write(c.b)
+		c.release()
+	}
+
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("read back %d bytes that differ from the %d written", got.Len(), want.Len())
+	}
+	// 100000 bytes on either side of the marker fit in 4 chunks each.
+	if chunks > 8 {
+		t.Errorf("audio queued in %d chunks, want at most 8", chunks)
+	}
+}
+
+// BenchmarkChannelWriter measures handing audio from Write to next, in the
+// write sizes a network read typically returns.
+func BenchmarkChannelWriter(b *testing.B) {
+	for _, size := range []int{1024, 4096, chunkSize} {
+		b.Run(fmt.Sprintf("write=%d", size), func(b *testing.B) {
+			cw := NewChannelWriter("benchmark", 8<<20, BufferBlock, "", slog.New(slog.DiscardHandler))
+			p := make([]byte, size)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for {
+					c, ok := cw.next()
+					if !ok {
+						return
+					}
+					c.release()
+				}
+			}()
+
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := cw.Write(p); err != nil {
+					b.Fatal(err)
+				}
+			}
+			cw.Close()
+			<-done
+		})
+	}
+}
+
+// newTestStation returns a station recording into a temporary directory.
+// Its writer loop isn't running.
+func newTestStation(t *testing.T) *station {
+	t.Helper()
+	logger := slog.New(slog.DiscardHandler)
+	return &station{
+		cfg:    StationConfig{Name: "test", Dir: t.TempDir()},
+		logger: logger,
+		w:      NewChannelWriter("test", 1<<20, BufferBlock, "", logger),
+		fin:    newFinalizer(1, logger),
+	}
+}
+
+// startTestTrack queues a marker for a track named after its position
+// among the tracks of s.
+func startTestTrack(t *testing.T, s *station, contentType string, n int) {
+	t.Helper()
+	err := s.w.StartTrack(&track{
+		name:   path.Join(s.cfg.Dir, fmt.Sprintf("%02d", n)),
+		offset: s.w.Written(),
+		time:   time.Now(),
+		src:    &source{contentType: contentType},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recordTracks runs the writer loop of s over audio, in writes of at most
+// size bytes, starting a track at each of offsets. It returns the audio of
+// the recordings, in order.
+func recordTracks(t *testing.T, s *station, contentType string, audio []byte, offsets []int64, size int) [][]byte {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.writeLoop()
+	}()
+
+	var written int64
+	for i, off := range append(offsets, int64(len(audio))) {
+		for written < off {
+			n := min(int64(size), off-written)
+			if _, err := s.w.Write(audio[written : written+n]); err != nil {
+				t.Fatal(err)
+			}
+			written += n
+		}
+		if i < len(offsets) {
+			startTestTrack(t, s, contentType, i)
+		}
+	}
+	s.w.Close()
+	<-done
+	s.fin.close()
+
+	return recordings(t, s.cfg.Dir)
+}
+
+// recordings returns the audio of the recordings in dir, in name order,
+// without the ID3 tag and, for MP3, the Xing frame in front of it.
+func recordings(t *testing.T, dir string) [][]byte {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(files)
+
+	var audio [][]byte
+	for _, name := range files {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, n, ok := id3.Parse(b); ok {
+			b = b[n:]
+		}
+		if h, ok := mpegaudio.ParseHeader(b); ok && h.FrameLen() <= len(b) {
+			if _, ok := mpegaudio.ParseXing(b[:h.FrameLen()]); ok {
+				b = b[h.FrameLen():]
+			}
+		}
+		audio = append(audio, b)
+	}
+	return audio
+}
+
+// TestWriteLoopTrackOffsets checks that each recording starts exactly at
+// the offset of its track marker and ends where the next one starts.
+func TestWriteLoopTrackOffsets(t *testing.T) {
+	const frameLen = 371
+	audio := adtsStream(rand.New(rand.NewPCG(1, 2)), 30)
+	offsets := []int64{0, 5 * frameLen, 6 * frameLen, 20 * frameLen}
+
+	for _, size := range []int{100, 3 * frameLen, chunkSize} {
+		t.Run(fmt.Sprintf("write %d", size), func(t *testing.T) {
+			got := recordTracks(t, newTestStation(t), "audio/aac", audio, offsets, size)
+			if len(got) != len(offsets) {
+				t.Fatalf("%d recordings, want %d", len(got), len(offsets))
+			}
+			for i, off := range offsets {
+				end := int64(len(audio))
+				if i+1 < len(offsets) {
+					end = offsets[i+1]
+				}
+				if !bytes.Equal(got[i], audio[off:end]) {
+					t.Errorf("recording %d has %d bytes that aren't the %d from %d to %d", i, len(got[i]), end-off, off, end)
+				}
+			}
+		})
+	}
+}
+
+// TestSplitWriter checks that time-split recordings start with the write
+// that triggered the split.
+func TestSplitWriter(t *testing.T) {
+	const frameLen = 371
+	audio := adtsStream(rand.New(rand.NewPCG(1, 2)), 12)
+	writes := [][]byte{audio[:4*frameLen], audio[4*frameLen : 9*frameLen], audio[9*frameLen:]}
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		want     [][]byte
+	}{
+		{"split every write", 0, writes},
+		{"single split", time.Hour, [][]byte{audio}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStation(t)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				s.writeLoop()
+			}()
+
+			n := 0
+			sw := newSplitWriter(s.w, tt.interval, func(time.Time) {
+				startTestTrack(t, s, "audio/aac", n)
+				n++
+			})
+			for _, w := range writes {
+				if _, err := sw.Write(w); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.w.Close()
+			<-done
+			s.fin.close()
+
+			got := recordings(t, s.cfg.Dir)
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d recordings, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Errorf("recording %d has %d bytes, want the %d written", i, len(got[i]), len(tt.want[i]))
+				}
+			}
+		})
+	}
+}
+
+// TestWriteLoopMidFrameMarker checks that a track marker in the middle of
+// an MP3 frame moves that frame whole into the next recording, so that no
+// audio is lost or written twice.
+func TestWriteLoopMidFrameMarker(t *testing.T) {
+	const frameLen = 417
+	audio := mp3Stream(rand.New(rand.NewPCG(1, 2)), 30)
+	offsets := []int64{0, 5*frameLen + 100, 12*frameLen + 1, 20*frameLen - 1}
+
+	for _, size := range []int{100, 3 * frameLen, chunkSize} {
+		t.Run(fmt.Sprintf("write %d", size), func(t *testing.T) {
+			got := recordTracks(t, newTestStation(t), "audio/mpeg", audio, offsets, size)
+			if len(got) != len(offsets) {
+				t.Fatalf("%d recordings, want %d", len(got), len(offsets))
+			}
+			if joined := bytes.Join(got, nil); !bytes.Equal(joined, audio) {
+				t.Errorf("recordings hold %d bytes that aren't the %d recorded", len(joined), len(audio))
+			}
+			for i, off := range offsets {
+				start := off - off%frameLen
+				end := int64(len(audio))
+				if i+1 < len(offsets) {
+					end = offsets[i+1] - offsets[i+1]%frameLen
+				}
+				if !bytes.Equal(got[i], audio[start:end]) {
+					t.Errorf("recording %d has %d bytes that aren't the %d from %d to %d", i, len(got[i]), end-start, start, end)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package ripper
+
+import (
+	"io"
+	"os"
+
+	"github.com/zachfi/streamgo/pkg/mpegaudio"
+)
+
+// maxTOCSamples bounds the frame offsets kept for a recording's seek table.
+// When there are more, every other one is dropped, so a long recording
+// costs no more memory than a short one.
+const maxTOCSamples = 4096
+
+// xingWriter keeps a Xing/Info frame up to date for an MP3 recording. A
+// placeholder is written in front of the audio when the file is created and
+// overwritten with the frame count, byte count and seek table on commit.
+type xingWriter struct {
+	first  mpegaudio.Header
+	offset int64 // of the Xing frame in the file
+	size   int   // of the Xing frame
+
+	frames int
+	bytes  int64 // audio after the Xing frame
+	vbr    bool
+
+	// offsets holds the position of every step-th frame, relative to the
+	// first audio frame.
+	step    int
+	offsets []int64
+}
+
+// newXingWriter writes a placeholder Xing frame for the stream that first
+// belongs to at the current position of f. It returns nil if first isn't
+// Layer III, which has no Xing header.
+func newXingWriter(f *os.File, first mpegaudio.Header) (*xingWriter, error) {
+	frame, ok := mpegaudio.Xing{}.Frame(first)
+	if !ok {
+		return nil, nil
+	}
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(frame); err != nil {
+		return nil, err
+	}
+	return &xingWriter{first: first, offset: offset, size: len(frame), step: 1}, nil
+}
+
+// add records the frame b, just written after the previous ones.
+func (xw *xingWriter) add(b []byte) {
+	if h, ok := mpegaudio.ParseHeader(b); ok && h.Bitrate != xw.first.Bitrate {
+		xw.vbr = true
+	}
+
+	if xw.frames%xw.step == 0 {
+		xw.offsets = append(xw.offsets, xw.bytes)
+		if len(xw.offsets) > maxTOCSamples {
+			n := (len(xw.offsets) + 1) / 2
+			for i := range n {
+				xw.offsets[i] = xw.offsets[2*i]
+			}
+			xw.offsets = xw.offsets[:n]
+			xw.step *= 2
+		}
+	}
+	xw.frames++
+	xw.bytes += int64(len(b))
+}
+
+// commit overwrites the placeholder with the final Xing frame.
+func (xw *xingWriter) commit(f *os.File) error {
+	total := int64(xw.size) + xw.bytes
+	x := mpegaudio.Xing{
+		VBR:    xw.vbr,
+		Frames: xw.frames,
+		Bytes:  int(total),
+	}
+	for i := range x.TOC {
+		frame := i * xw.frames / len(x.TOC)
+		pos := int64(xw.size)
+		if idx := frame / xw.step; idx < len(xw.offsets) {
+			pos += xw.offsets[idx]
+		}
+		x.TOC[i] = byte(min(pos*256/total, 255))
+	}
+
+	frame, _ := x.Frame(xw.first)
+	_, err := f.WriteAt(frame, xw.offset)
+	return err
+}
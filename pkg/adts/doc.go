@@ -0,0 +1,10 @@
+// Package adts parses the frame headers of ADTS (Audio Data Transport Stream), the framing used for
+// AAC over Shoutcast and Icecast.
+//
+// It is used to cut recordings on frame boundaries and to work out their duration:
+//   - ParseHeader decodes a 7 byte frame header: profile, sample rate, channel configuration,
+//     frame length and the number of raw data blocks, from which the frame's sample count and
+//     duration follow
+//   - FindSync only accepts a sync word that is followed by a chain of frames from the same stream,
+//     since 0xFF 0xF? pairs turn up all the time inside AAC data
+package adts
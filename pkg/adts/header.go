@@ -0,0 +1,115 @@
+package adts
+
+import "time"
+
+// HeaderLen is the length of a frame header without a CRC. A CRC, if
+// present, adds two bytes.
+const HeaderLen = 7
+
+// samplesPerBlock is the number of samples per channel in a raw data
+// block.
+const samplesPerBlock = 1024
+
+// Sample rates in Hz by sample rate index; indexes 13 to 15 are reserved.
+var sampleRates = [...]int{
+	96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// Header is a decoded frame header.
+type Header struct {
+	MPEG2         bool // MPEG-2 rather than MPEG-4 AAC
+	CRC           bool // a 16-bit CRC follows the header
+	Profile       int  // audio object type minus one; 1 is AAC LC
+	SampleRate    int  // Hz
+	ChannelConfig int  // 0 means the channels are given in-band
+	FrameLen      int  // bytes, including the header
+	Blocks        int  // raw data blocks in the frame
+}
+
+// ParseHeader decodes the frame header at the start of b. It returns false
+// if b is shorter than HeaderLen or doesn't start with a valid header: a
+// sync word followed by layer 0, a sample rate that isn't reserved and a
+// frame length that covers the header.
+func ParseHeader(b []byte) (Header, bool) {
+	if len(b) < HeaderLen || b[0] != 0xFF || b[1]&0xF6 != 0xF0 {
+		return Header{}, false
+	}
+
+	sampleRateIndex := int(b[2]>>2) & 0x0F
+	if sampleRateIndex >= len(sampleRates) {
+		return Header{}, false
+	}
+	h := Header{
+		MPEG2:         b[1]&0x08 != 0,
+		CRC:           b[1]&0x01 == 0,
+		Profile:       int(b[2] >> 6),
+		SampleRate:    sampleRates[sampleRateIndex],
+		ChannelConfig: int(b[2]&0x01)<<2 | int(b[3]>>6),
+		FrameLen:      int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5])>>5,
+		Blocks:        int(b[6]&0x03) + 1,
+	}
+	if h.FrameLen < h.headerLen() {
+		return Header{}, false
+	}
+	return h, true
+}
+
+// headerLen returns the length of the header, including any CRC.
+func (h Header) headerLen() int {
+	if h.CRC {
+		return HeaderLen + 2
+	}
+	return HeaderLen
+}
+
+// Samples returns the number of samples per channel in the frame.
+func (h Header) Samples() int {
+	return h.Blocks * samplesPerBlock
+}
+
+// Duration returns how long the frame plays for.
+func (h Header) Duration() time.Duration {
+	return time.Duration(h.Samples()) * time.Second / time.Duration(h.SampleRate)
+}
+
+// SameStream reports whether o can follow h in the same stream. Only the
+// frame length, block count and buffer fullness change from frame to frame.
+func (h Header) SameStream(o Header) bool {
+	return h.MPEG2 == o.MPEG2 && h.Profile == o.Profile &&
+		h.SampleRate == o.SampleRate && h.ChannelConfig == o.ChannelConfig
+}
+
+// FindSync returns the offset of the first frame in b that is followed by
+// at least chain-1 more frames of the same stream, each starting where the
+// previous one ends. It returns -1 if there is none; b may just be too
+// short to hold the whole chain.
+func FindSync(b []byte, chain int) int {
+	for i := 0; i+HeaderLen <= len(b); i++ {
+		if b[i] != 0xFF {
+			continue
+		}
+		h, ok := ParseHeader(b[i:])
+		if !ok {
+			continue
+		}
+		if chained(b[i:], h, chain) {
+			return i
+		}
+	}
+	return -1
+}
+
+// chained reports whether the frame h at the start of b is followed by
+// chain-1 frames of the same stream.
+func chained(b []byte, h Header, chain int) bool {
+	off := 0
+	for n := 1; n < chain; n++ {
+		off += h.FrameLen
+		next, ok := ParseHeader(b[min(off, len(b)):])
+		if !ok || !h.SameStream(next) {
+			return false
+		}
+		h = next
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package adts
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want Header
+	}{
+		{
+			name: "AAC LC 44.1 kHz stereo",
+			b:    []byte{0xFF, 0xF1, 0x50, 0x80, 0x2E, 0x7F, 0xFC},
+			want: Header{Profile: 1, SampleRate: 44100, ChannelConfig: 2, FrameLen: 371, Blocks: 1},
+		},
+		{
+			name: "MPEG-2 with CRC, 48 kHz mono, two blocks",
+			b:    []byte{0xFF, 0xF8, 0x4C, 0x40, 0x20, 0x1F, 0xFD},
+			want: Header{MPEG2: true, CRC: true, Profile: 1, SampleRate: 48000, ChannelConfig: 1, FrameLen: 256, Blocks: 2},
+		},
+		{
+			name: "HE-AAC 24 kHz channel config in band",
+			b:    []byte{0xFF, 0xF1, 0x98, 0x00, 0x10, 0x1F, 0xFC},
+			want: Header{Profile: 2, SampleRate: 24000, FrameLen: 128, Blocks: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, ok := ParseHeader(tt.b)
+			if !ok || h != tt.want {
+				t.Errorf("ParseHeader(% X) = %+v, %v, want %+v", tt.b, h, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHeaderInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"short", []byte{0xFF, 0xF1, 0x50, 0x80, 0x2E, 0x7F}},
+		{"no sync", []byte{0xFF, 0xE1, 0x50, 0x80, 0x2E, 0x7F, 0xFC}},
+		{"MPEG audio layer", []byte{0xFF, 0xFB, 0x90, 0x64, 0x2E, 0x7F, 0xFC}},
+		{"reserved sample rate", []byte{0xFF, 0xF1, 0x74, 0x80, 0x2E, 0x7F, 0xFC}},
+		{"frame shorter than header", []byte{0xFF, 0xF1, 0x50, 0x80, 0x00, 0xDF, 0xFC}},
+		{"frame shorter than header with CRC", []byte{0xFF, 0xF0, 0x50, 0x80, 0x01, 0x1F, 0xFC}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if h, ok := ParseHeader(tt.b); ok {
+				t.Errorf("ParseHeader(% X) = %+v, want failure", tt.b, h)
+			}
+		})
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		h        Header
+		samples  int
+		duration time.Duration
+	}{
+		{Header{SampleRate: 48000, Blocks: 1}, 1024, 21333333 * time.Nanosecond},
+		{Header{SampleRate: 48000, Blocks: 2}, 2048, 42666666 * time.Nanosecond},
+		{Header{SampleRate: 44100, Blocks: 1}, 1024, 23219954 * time.Nanosecond},
+		{Header{SampleRate: 8000, Blocks: 4}, 4096, 512 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		if n := tt.h.Samples(); n != tt.samples {
+			t.Errorf("%+v: Samples() = %d, want %d", tt.h, n, tt.samples)
+		}
+		if d := tt.h.Duration(); d != tt.duration {
+			t.Errorf("%+v: Duration() = %v, want %v", tt.h, d, tt.duration)
+		}
+	}
+}
+
+// frames returns n frames of the stream with the given header, with a
+// payload of 0xFF bytes, which are all sync candidates.
+func frames(hdr []byte, n int) []byte {
+	h, _ := ParseHeader(hdr)
+	frame := bytes.Repeat([]byte{0xFF}, h.FrameLen)
+	copy(frame, hdr)
+	return bytes.Repeat(frame, n)
+}
+
+func TestFindSync(t *testing.T) {
+	stream := frames([]byte{0xFF, 0xF1, 0x50, 0x80, 0x2E, 0x7F, 0xFC}, 4)
+	resampled := append(frames([]byte{0xFF, 0xF1, 0x50, 0x80, 0x2E, 0x7F, 0xFC}, 1),
+		frames([]byte{0xFF, 0xF1, 0x4C, 0x80, 0x2E, 0x7F, 0xFC}, 3)...)
+
+	tests := []struct {
+		name  string
+		b     []byte
+		chain int
+		want  int
+	}{
+		{"start", stream, 2, 0},
+		{"mid-frame", stream[100:], 2, 271},
+		{"lone header", append([]byte{0xFF, 0xF1, 0x50, 0x80, 0x2E, 0x7F, 0xFC, 0}, stream...), 2, 8},
+		{"next header cut short", stream[:371+HeaderLen-1], 2, -1},
+		{"last header", stream[3*371:], 2, -1},
+		{"single frame", stream[3*371:], 1, 0},
+		{"sample rate changes", resampled, 2, 371},
+		{"nothing", make([]byte, 1000), 1, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FindSync(tt.b, tt.chain); got != tt.want {
+				t.Errorf("FindSync() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
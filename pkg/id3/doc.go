@@ -0,0 +1,12 @@
+// Package id3 reads and writes ID3v2 tags.
+//
+// It covers what a stream recorder needs to label its files and to read the
+// timed metadata of HLS segments:
+//   - Text frames (T***), with several values where the version allows it
+//   - URL link frames (W***), comment frames (COMM) and user defined text frames (TXXX)
+//   - ID3v2.4 with UTF-8 text, or ID3v2.3 with ISO-8859-1 or UTF-16 text for older players; v2.4-only
+//     frames are converted (TDRC to TYER, TDAT and TIME) or left out
+//   - ID3v1.1 trailers, with fields converted to ISO-8859-1 and cut to length
+//   - Padding to a fixed size, so a tag can be rewritten in place once the recording's length is known
+//   - Reading the text frames of ID3v2.3 and ID3v2.4 tags, in any of their text encodings
+package id3
@@ -0,0 +1,124 @@
+package id3
+
+import (
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+)
+
+// Parse reads the ID3v2 tag at the start of b. It returns the tag with its
+// text frames and the tag's length, including any footer, or false if b
+// doesn't start with a whole tag. Only ID3v2.3 and ID3v2.4 frames are read;
+// the tag of another version is returned empty, so that it can still be
+// skipped.
+func Parse(b []byte) (*Tag, int, bool) {
+	if len(b) < HeaderLen || string(b[:3]) != "ID3" {
+		return nil, 0, false
+	}
+	version := Version(b[3])
+	flags := b[5]
+	size := synchsafe(b[6:10])
+	total := HeaderLen + size
+	if flags&0x10 != 0 {
+		total += HeaderLen // footer
+	}
+	if total > len(b) {
+		return nil, 0, false
+	}
+
+	t := &Tag{Version: version}
+	if version != V23 && version != V24 {
+		return t, total, true
+	}
+
+	body := b[HeaderLen : HeaderLen+size]
+	if flags&0x40 != 0 && len(body) >= 4 {
+		// Skip the extended header, whose size includes itself in ID3v2.4
+		// only.
+		ext := int(binary.BigEndian.Uint32(body))
+		if version == V24 {
+			ext = synchsafe(body)
+		} else {
+			ext += 4
+		}
+		if ext > len(body) {
+			return t, total, true
+		}
+		body = body[ext:]
+	}
+
+	for len(body) >= HeaderLen && body[0] != 0 {
+		id := string(body[:4])
+		n := int(binary.BigEndian.Uint32(body[4:8]))
+		if version == V24 {
+			n = synchsafe(body[4:8])
+		}
+		if HeaderLen+n > len(body) {
+			break
+		}
+		content := body[HeaderLen : HeaderLen+n]
+		if id[0] == 'T' && id != "TXXX" && len(content) > 0 {
+			t.SetText(id, decodeText(content[0], content[1:])...)
+		}
+		body = body[HeaderLen+n:]
+	}
+
+	return t, total, true
+}
+
+// Text returns the values of the text frame id, or nil if the tag has none.
+func (t *Tag) Text(id string) []string {
+	for _, f := range t.frames {
+		if f.id == id && f.kind == kindText {
+			return f.values
+		}
+	}
+	return nil
+}
+
+// synchsafe decodes a four byte synchsafe integer.
+func synchsafe(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
+
+// decodeText decodes the NUL separated values of a text frame in enc to
+// UTF-8.
+func decodeText(enc byte, b []byte) []string {
+	var s string
+	switch enc {
+	case encodingLatin1:
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		s = string(r)
+	case encodingUTF16, encodingUTF16BE:
+		bigEndian := enc == encodingUTF16BE
+		if len(b) >= 2 {
+			switch {
+			case b[0] == 0xFF && b[1] == 0xFE:
+				bigEndian, b = false, b[2:]
+			case b[0] == 0xFE && b[1] == 0xFF:
+				bigEndian, b = true, b[2:]
+			}
+		}
+		u := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			if bigEndian {
+				u = append(u, binary.BigEndian.Uint16(b[i:]))
+			} else {
+				u = append(u, binary.LittleEndian.Uint16(b[i:]))
+			}
+		}
+		s = string(utf16.Decode(u))
+	default:
+		s = string(b)
+	}
+
+	// Each UTF-16 value after the first has a BOM of its own.
+	values := strings.Split(s, "\x00")
+	for i, v := range values {
+		values[i] = strings.TrimPrefix(v, "\uFEFF")
+	}
+	return values
+}
@@ -0,0 +1,137 @@
+package id3
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		version Version
+		text    map[string][]string
+	}{
+		{
+			name:    "v2.4",
+			version: V24,
+			text:    map[string][]string{"TPE1": {"Björk"}, "TIT2": {"Jóga"}, "TCON": {"Pop", "Electronic"}},
+		},
+		{
+			name:    "v2.3 latin-1",
+			version: V23,
+			text:    map[string][]string{"TPE1": {"Björk"}, "TIT2": {"Jóga"}},
+		},
+		{
+			name:    "v2.3 utf-16",
+			version: V23,
+			text:    map[string][]string{"TPE1": {"坂本龍一"}, "TIT2": {"Merry Christmas Mr. Lawrence"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag := New()
+			tag.Version = tt.version
+			for id, values := range tt.text {
+				tag.SetText(id, values...)
+			}
+			tag.SetURL("WORS", "http://example.com/")
+			tag.SetComment("eng", "", "a comment")
+			b := tag.Encode(512)
+
+			got, n, ok := Parse(append(b, 0xFF, 0xFB))
+			if !ok {
+				t.Fatal("Parse failed")
+			}
+			if n != len(b) {
+				t.Errorf("Parse() length = %d, want %d", n, len(b))
+			}
+			if got.Version != tt.version {
+				t.Errorf("Parse() version = %d, want %d", got.Version, tt.version)
+			}
+			for id, values := range tt.text {
+				if v := got.Text(id); !slices.Equal(v, values) {
+					t.Errorf("Text(%q) = %q, want %q", id, v, values)
+				}
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		b      []byte
+		want   map[string][]string
+		wantN  int
+		wantOK bool
+	}{
+		{
+			name: "v2.3 utf-16 with extended header",
+			b: []byte{
+				'I', 'D', '3', 3, 0, 0x40, 0, 0, 0, 25,
+				0, 0, 0, 6, 0, 0, 0, 0, 0, 0, // extended header, size excluding itself
+				'T', 'I', 'T', '2', 0, 0, 0, 5, 0, 0, 1, 0xFF, 0xFE, 'H', 0,
+			},
+			want:   map[string][]string{"TIT2": {"H"}},
+			wantN:  35,
+			wantOK: true,
+		},
+		{
+			name: "v2.4 utf-16be with footer",
+			b: []byte{
+				'I', 'D', '3', 4, 0, 0x10, 0, 0, 0, 15,
+				'T', 'P', 'E', '1', 0, 0, 0, 5, 0, 0, 2, 0, 'A', 0, 'B',
+				'3', 'D', 'I', 4, 0, 0x10, 0, 0, 0, 15,
+			},
+			want:   map[string][]string{"TPE1": {"AB"}},
+			wantN:  35,
+			wantOK: true,
+		},
+		{
+			name: "user text frames are skipped",
+			b: []byte{
+				'I', 'D', '3', 4, 0, 0, 0, 0, 0, 16,
+				'T', 'X', 'X', 'X', 0, 0, 0, 6, 0, 0, 3, 'k', 0, 'v', 0, 0,
+			},
+			want:   map[string][]string{},
+			wantN:  26,
+			wantOK: true,
+		},
+		{
+			name:   "v2.2 is skipped",
+			b:      []byte{'I', 'D', '3', 2, 0, 0, 0, 0, 0, 6, 'T', 'T', '2', 0, 0, 0},
+			want:   map[string][]string{},
+			wantN:  16,
+			wantOK: true,
+		},
+		{
+			name: "truncated",
+			b:    []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 1, 0, 0, 0},
+		},
+		{
+			name: "not a tag",
+			b:    []byte{0xFF, 0xFB, 0x90, 0x64, 0, 0, 0, 0, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, n, ok := Parse(tt.b)
+			if ok != tt.wantOK || n != tt.wantN {
+				t.Fatalf("Parse() = %d, %v, want %d, %v", n, ok, tt.wantN, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if len(tag.frames) != len(tt.want) {
+				t.Errorf("Parse() read %d frames, want %d", len(tag.frames), len(tt.want))
+			}
+			for id, values := range tt.want {
+				if v := tag.Text(id); !slices.Equal(v, values) {
+					t.Errorf("Text(%q) = %q, want %q", id, v, values)
+				}
+			}
+		})
+	}
+}
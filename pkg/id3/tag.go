@@ -0,0 +1,269 @@
+package id3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// HeaderLen is the length of the tag header and of each frame header.
+const HeaderLen = 10
+
+// Text encodings.
+const (
+	encodingLatin1  = 0x00
+	encodingUTF16   = 0x01 // with BOM
+	encodingUTF16BE = 0x02 // ID3v2.4 only, and only ever read
+	encodingUTF8    = 0x03 // ID3v2.4 only
+)
+
+// Version is the ID3v2 major version a tag is written as.
+type Version byte
+
+const (
+	V23 Version = 3
+	V24 Version = 4
+)
+
+type frameKind int
+
+const (
+	kindText frameKind = iota
+	kindURL
+	kindComment
+	kindUserText
+)
+
+type frame struct {
+	id     string
+	kind   frameKind
+	values []string // text: the values; URL: the URL; comment, user text: the text
+	lang   string   // comment only
+	desc   string   // comment and user text only
+}
+
+// Tag is an ID3v2 tag being built to be written, or one read by Parse.
+// Frames are written in the order they were first set.
+type Tag struct {
+	// Version is the version Encode writes; anything but V23 means V24.
+	// Frames are set as ID3v2.4 frames either way and converted for V23.
+	Version Version
+
+	frames []frame
+}
+
+// New returns an empty ID3v2.4 tag.
+func New() *Tag {
+	return &Tag{Version: V24}
+}
+
+// ValidID reports whether id is a well-formed frame ID: four upper case
+// letters or digits, starting with a letter.
+func ValidID(id string) bool {
+	if len(id) != 4 || id[0] < 'A' || id[0] > 'Z' {
+		return false
+	}
+	for _, c := range []byte(id[1:]) {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// SetText sets the text frame id, such as "TIT2", to values. Empty values
+// are left out, and a frame without values removes id from the tag.
+func (t *Tag) SetText(id string, values ...string) {
+	var vs []string
+	for _, v := range values {
+		if v = clean(v); v != "" {
+			vs = append(vs, v)
+		}
+	}
+	t.set(frame{id: id, kind: kindText, values: vs}, len(vs) == 0)
+}
+
+// SetURL sets the URL link frame id, such as "WORS". An empty URL removes
+// id from the tag.
+func (t *Tag) SetURL(id, url string) {
+	url = clean(url)
+	t.set(frame{id: id, kind: kindURL, values: []string{url}}, url == "")
+}
+
+// SetComment sets the comment with the given language, a three letter ISO
+// 639-2 code, and description. Comments with a different language or
+// description are kept. Empty text removes the comment.
+func (t *Tag) SetComment(lang, desc, text string) {
+	text = clean(text)
+	t.set(frame{id: "COMM", kind: kindComment, values: []string{text}, lang: lang, desc: clean(desc)}, text == "")
+}
+
+// SetUserText sets the user defined text frame (TXXX) with the given
+// description. Frames with a different description are kept. Empty text
+// removes the frame.
+func (t *Tag) SetUserText(desc, text string) {
+	text = clean(text)
+	t.set(frame{id: "TXXX", kind: kindUserText, values: []string{text}, desc: clean(desc)}, text == "")
+}
+
+func (t *Tag) set(f frame, remove bool) {
+	for i, g := range t.frames {
+		if g.id != f.id || g.lang != f.lang || g.desc != f.desc {
+			continue
+		}
+		if remove {
+			t.frames = append(t.frames[:i], t.frames[i+1:]...)
+		} else {
+			t.frames[i] = f
+		}
+		return
+	}
+	if !remove {
+		t.frames = append(t.frames, f)
+	}
+}
+
+// Encode returns the tag in its version, padded with zeros to size bytes if
+// it is shorter than that. It panics if the tag is larger than the 256 MiB
+// the format allows.
+func (t *Tag) Encode(size int) []byte {
+	v := t.Version
+	if v != V23 {
+		v = V24
+	}
+	frames := t.frames
+	if v == V23 {
+		frames = framesV23(frames)
+	}
+
+	var body bytes.Buffer
+	for _, f := range frames {
+		data := f.encode(v)
+		var hdr [HeaderLen]byte
+		copy(hdr[:4], f.id)
+		if v == V24 {
+			putSynchsafe(hdr[4:8], len(data))
+		} else {
+			binary.BigEndian.PutUint32(hdr[4:8], uint32(len(data)))
+		}
+		body.Write(hdr[:])
+		body.Write(data)
+	}
+	if pad := size - HeaderLen - body.Len(); pad > 0 {
+		body.Write(make([]byte, pad))
+	}
+
+	out := make([]byte, HeaderLen, HeaderLen+body.Len())
+	copy(out, "ID3")
+	out[3] = byte(v) // revision 0, no flags
+	putSynchsafe(out[6:10], body.Len())
+	return append(out, body.Bytes()...)
+}
+
+// encode returns the frame's content. ID3v2.4 text is UTF-8. ID3v2.3 has no
+// UTF-8, so text is ISO-8859-1 where it can be and UTF-16 with a BOM where
+// it can't, and several values are joined with "/".
+func (f frame) encode(v Version) []byte {
+	var b bytes.Buffer
+	switch f.kind {
+	case kindText:
+		if v == V24 {
+			b.WriteByte(encodingUTF8)
+			b.WriteString(strings.Join(f.values, "\x00"))
+			break
+		}
+		text := strings.Join(f.values, "/")
+		enc := encodingFor(text)
+		b.WriteByte(enc)
+		writeString(&b, enc, text, false)
+	case kindURL:
+		b.WriteString(asciiURL(f.values[0]))
+	case kindComment, kindUserText:
+		enc := byte(encodingUTF8)
+		if v == V23 {
+			enc = encodingFor(f.desc, f.values[0])
+		}
+		b.WriteByte(enc)
+		if f.kind == kindComment {
+			if len(f.lang) == 3 {
+				b.WriteString(f.lang)
+			} else {
+				b.WriteString("XXX") // unknown language
+			}
+		}
+		writeString(&b, enc, f.desc, true)
+		writeString(&b, enc, f.values[0], false)
+	}
+	return b.Bytes()
+}
+
+// encodingFor returns ISO-8859-1 if it can hold all of ss, otherwise UTF-16.
+func encodingFor(ss ...string) byte {
+	for _, s := range ss {
+		for _, r := range s {
+			if r > 0xFF {
+				return encodingUTF16
+			}
+		}
+	}
+	return encodingLatin1
+}
+
+// writeString writes s in enc, followed by the encoding's terminator if
+// terminate is set.
+func writeString(b *bytes.Buffer, enc byte, s string, terminate bool) {
+	switch enc {
+	case encodingLatin1:
+		for _, r := range s {
+			b.WriteByte(byte(r))
+		}
+		if terminate {
+			b.WriteByte(0)
+		}
+	case encodingUTF16:
+		b.Write([]byte{0xFF, 0xFE}) // BOM, little endian
+		for _, u := range utf16.Encode([]rune(s)) {
+			b.Write([]byte{byte(u), byte(u >> 8)})
+		}
+		if terminate {
+			b.Write([]byte{0, 0})
+		}
+	default:
+		b.WriteString(s)
+		if terminate {
+			b.WriteByte(0)
+		}
+	}
+}
+
+// putSynchsafe stores n in b as a four byte synchsafe integer, seven bits
+// per byte, so that a tag never contains a false MPEG sync.
+func putSynchsafe(b []byte, n int) {
+	if n >= 1<<28 {
+		panic(fmt.Sprintf("id3: size %d too large", n))
+	}
+	binary.BigEndian.PutUint32(b, uint32(n&0x7F|(n&0x3F80)<<1|(n&0x1FC000)<<2|(n&0xFE00000)<<3))
+}
+
+// clean removes NULs, which separate values, and surrounding space.
+func clean(s string) string {
+	return strings.TrimSpace(strings.ReplaceAll(s, "\x00", ""))
+}
+
+// asciiURL percent-encodes the non-ASCII characters in a URL, as URL frames
+// are limited to ISO-8859-1.
+func asciiURL(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < 0x80 {
+			b.WriteRune(r)
+			continue
+		}
+		for _, c := range []byte(string(r)) {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,119 @@
+package id3
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	long := strings.Repeat("a", 200)
+
+	tests := []struct {
+		name    string
+		version Version
+		text    [][]string  // frame ID, then values
+		user    [][2]string // description, text
+		size    int
+		want    []byte
+	}{
+		{
+			name:    "v2.4",
+			version: V24,
+			text:    [][]string{{"TIT2", "Hi"}, {"TCON", "Pop", "Rock"}},
+			want: cat(
+				[]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 32},
+				[]byte{'T', 'I', 'T', '2', 0, 0, 0, 3, 0, 0, 3, 'H', 'i'},
+				[]byte{'T', 'C', 'O', 'N', 0, 0, 0, 9, 0, 0, 3, 'P', 'o', 'p', 0, 'R', 'o', 'c', 'k'},
+			),
+		},
+		{
+			name:    "v2.4 synchsafe frame size",
+			version: V24,
+			text:    [][]string{{"TIT2", long}},
+			want: cat(
+				[]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 1, 0x53},
+				[]byte{'T', 'I', 'T', '2', 0, 0, 1, 0x49, 0, 0, 3},
+				[]byte(long),
+			),
+		},
+		{
+			name:    "v2.3 plain frame size",
+			version: V23,
+			text:    [][]string{{"TIT2", long}},
+			want: cat(
+				[]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 1, 0x53},
+				[]byte{'T', 'I', 'T', '2', 0, 0, 0, 0xC9, 0, 0, 0},
+				[]byte(long),
+			),
+		},
+		{
+			name:    "v2.3 latin-1 values joined",
+			version: V23,
+			text:    [][]string{{"TPE1", "Björk", "Guy"}},
+			want: cat(
+				[]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 20},
+				[]byte{'T', 'P', 'E', '1', 0, 0, 0, 10, 0, 0, 0, 'B', 'j', 0xF6, 'r', 'k', '/', 'G', 'u', 'y'},
+			),
+		},
+		{
+			name:    "v2.3 utf-16 with BOM",
+			version: V23,
+			text:    [][]string{{"TIT2", "Ωa"}},
+			want: cat(
+				[]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 17},
+				[]byte{'T', 'I', 'T', '2', 0, 0, 0, 7, 0, 0, 1, 0xFF, 0xFE, 0xA9, 0x03, 'a', 0},
+			),
+		},
+		{
+			name:    "v2.4 user text",
+			version: V24,
+			user:    [][2]string{{"bitrate", "128"}, {"channels", "2"}, {"bitrate", "96"}},
+			want: cat(
+				[]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 42},
+				[]byte{'T', 'X', 'X', 'X', 0, 0, 0, 11, 0, 0, 3, 'b', 'i', 't', 'r', 'a', 't', 'e', 0, '9', '6'},
+				[]byte{'T', 'X', 'X', 'X', 0, 0, 0, 11, 0, 0, 3, 'c', 'h', 'a', 'n', 'n', 'e', 'l', 's', 0, '2'},
+			),
+		},
+		{
+			name:    "v2.3 utf-16 user text",
+			version: V23,
+			user:    [][2]string{{"Ω", "1"}},
+			want: cat(
+				[]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 21},
+				[]byte{'T', 'X', 'X', 'X', 0, 0, 0, 11, 0, 0, 1, 0xFF, 0xFE, 0xA9, 0x03, 0, 0, 0xFF, 0xFE, '1', 0},
+			),
+		},
+		{
+			name:    "padded",
+			version: V24,
+			text:    [][]string{{"TIT2", "Hi"}},
+			size:    30,
+			want: cat(
+				[]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 20},
+				[]byte{'T', 'I', 'T', '2', 0, 0, 0, 3, 0, 0, 3, 'H', 'i'},
+				make([]byte, 7),
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag := New()
+			tag.Version = tt.version
+			for _, f := range tt.text {
+				tag.SetText(f[0], f[1:]...)
+			}
+			for _, f := range tt.user {
+				tag.SetUserText(f[0], f[1])
+			}
+			if got := tag.Encode(tt.size); !bytes.Equal(got, tt.want) {
+				t.Errorf("Encode() =\n% X\nwant\n% X", got, tt.want)
+			}
+		})
+	}
+}
+
+func cat(bs ...[]byte) []byte {
+	return bytes.Join(bs, nil)
+}
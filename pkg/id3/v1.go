@@ -0,0 +1,105 @@
+package id3
+
+import (
+	"strconv"
+	"strings"
+)
+
+// V1Len is the length of an ID3v1 tag, which goes at the very end of a file.
+const V1Len = 128
+
+// genresV1 are the ID3v1 genres, indexed by genre byte.
+var genresV1 = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop",
+	"Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B", "Rap",
+	"Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska", "Death Metal", "Pranks",
+	"Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance",
+	"Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock",
+	"Ethnic", "Gothic", "Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk", "Jungle",
+	"Native American", "Cabaret", "New Wave", "Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi",
+	"Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+}
+
+// EncodeV1 returns the tag as ID3v1.1, the fixed 128 byte tag older
+// players read from the end of a file. Fields are ISO-8859-1, with other
+// characters replaced by '?', and cut to length: 30 bytes for the title
+// (TIT2), artist (TPE1) and album (TALB), 4 for the year (from TDRC) and 28
+// for the comment. The track number comes from TRCK and the genre from TCON
+// if it names, or numbers, one of the ID3v1 genres.
+func (t *Tag) EncodeV1() []byte {
+	b := make([]byte, V1Len)
+	copy(b, "TAG")
+	putV1(b[3:33], strings.Join(t.Text("TIT2"), " "))
+	putV1(b[33:63], strings.Join(t.Text("TPE1"), "/"))
+	putV1(b[63:93], strings.Join(t.Text("TALB"), " "))
+	putV1(b[93:97], field(first(t.Text("TDRC")), 0, 4))
+	putV1(b[97:125], t.comment())
+	// b[125] stays 0, which marks b[126] as the track number (ID3v1.1).
+	track, _, _ := strings.Cut(first(t.Text("TRCK")), "/")
+	if n, err := strconv.Atoi(track); err == nil && n > 0 && n < 256 {
+		b[126] = byte(n)
+	}
+	b[127] = genreV1(first(t.Text("TCON")))
+	return b
+}
+
+// putV1 stores s in the ID3v1 field b as ISO-8859-1, cut to fit; the rest
+// of b stays zero.
+func putV1(b []byte, s string) {
+	i := 0
+	for _, r := range s {
+		if i == len(b) {
+			return
+		}
+		if r > 0xFF {
+			r = '?'
+		}
+		b[i] = byte(r)
+		i++
+	}
+}
+
+// genreV1 returns the ID3v1 genre byte for a TCON value: a genre name, a
+// genre number, or an ID3v2.3 style "(17)" reference. 255 means none.
+func genreV1(s string) byte {
+	s = strings.TrimSpace(s)
+	if ref, ok := strings.CutPrefix(s, "("); ok {
+		s, _, _ = strings.Cut(ref, ")")
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n < len(genresV1) {
+		return byte(n)
+	}
+	for i, g := range genresV1 {
+		if strings.EqualFold(g, s) {
+			return byte(i)
+		}
+	}
+	return 255
+}
+
+// comment returns the text of the first comment with no description, or
+// of the first comment.
+func (t *Tag) comment() string {
+	var text string
+	for _, f := range t.frames {
+		if f.kind != kindComment {
+			continue
+		}
+		if f.desc == "" {
+			return f.values[0]
+		}
+		if text == "" {
+			text = f.values[0]
+		}
+	}
+	return text
+}
+
+func first(ss []string) string {
+	if len(ss) == 0 {
+		return ""
+	}
+	return ss[0]
+}
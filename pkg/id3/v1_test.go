@@ -0,0 +1,103 @@
+package id3
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncodeV1(t *testing.T) {
+	tag := New()
+	tag.SetText("TIT2", strings.Repeat("t", 29)+"Tx")
+	tag.SetText("TPE1", "Björk", "坂本龍一")
+	tag.SetText("TALB", strings.Repeat("a", 40))
+	tag.SetText("TDRC", "2024-03-07T18:45")
+	tag.SetComment("eng", "description", "ignored")
+	tag.SetComment("eng", "", strings.Repeat("c", 27)+"Cx")
+	tag.SetText("TRCK", "7/12")
+	tag.SetText("TCON", "(17)")
+
+	b := tag.EncodeV1()
+	if len(b) != V1Len {
+		t.Fatalf("EncodeV1() returned %d bytes, want %d", len(b), V1Len)
+	}
+
+	fields := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{"identifier", b[:3], "TAG"},
+		{"title", b[3:33], strings.Repeat("t", 29) + "T"},
+		{"artist", b[33:63], "Bj\xF6rk/????" + strings.Repeat("\x00", 20)},
+		{"album", b[63:93], strings.Repeat("a", 30)},
+		{"year", b[93:97], "2024"},
+		{"comment", b[97:125], strings.Repeat("c", 27) + "C"},
+		{"track marker", b[125:126], "\x00"},
+		{"track", b[126:127], "\x07"},
+		{"genre", b[127:], "\x11"},
+	}
+	for _, f := range fields {
+		if string(f.b) != f.want {
+			t.Errorf("%s = %q, want %q", f.name, f.b, f.want)
+		}
+	}
+}
+
+func TestEncodeV1Empty(t *testing.T) {
+	want := make([]byte, V1Len)
+	copy(want, "TAG")
+	want[127] = 255
+
+	if got := New().EncodeV1(); !bytes.Equal(got, want) {
+		t.Errorf("EncodeV1() = % X, want % X", got, want)
+	}
+}
+
+func TestEncodeV1Track(t *testing.T) {
+	tests := []struct {
+		trck string
+		want byte
+	}{
+		{"1", 1},
+		{"12/14", 12},
+		{"255", 255},
+		{"256", 0},
+		{"0", 0},
+		{"A1", 0},
+	}
+
+	for _, tt := range tests {
+		tag := New()
+		tag.SetText("TRCK", tt.trck)
+		if got := tag.EncodeV1()[126]; got != tt.want {
+			t.Errorf("TRCK %q: track byte = %d, want %d", tt.trck, got, tt.want)
+		}
+	}
+}
+
+func TestGenreV1(t *testing.T) {
+	tests := []struct {
+		tcon string
+		want byte
+	}{
+		{"Rock", 17},
+		{"rock", 17},
+		{" Hip-Hop ", 7},
+		{"17", 17},
+		{"(17)", 17},
+		{"(17)Rock", 17},
+		{"Hard Rock", 79},
+		{"0", 0},
+		{"80", 255},
+		{"-1", 255},
+		{"Shoegaze", 255},
+		{"", 255},
+	}
+
+	for _, tt := range tests {
+		if got := genreV1(tt.tcon); got != tt.want {
+			t.Errorf("genreV1(%q) = %d, want %d", tt.tcon, got, tt.want)
+		}
+	}
+}
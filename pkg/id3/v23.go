@@ -0,0 +1,51 @@
+package id3
+
+// framesV24Only are ID3v2.4 frames with no ID3v2.3 counterpart. They are
+// left out of ID3v2.3 tags.
+var framesV24Only = map[string]bool{
+	"ASPI": true, "EQU2": true, "RVA2": true, "SEEK": true, "SIGN": true,
+	"TDEN": true, "TDRL": true, "TDTG": true, "TIPL": true, "TMCL": true,
+	"TMOO": true, "TPRO": true, "TSOA": true, "TSOP": true, "TSOT": true,
+	"TSST": true,
+}
+
+// framesV23 converts ID3v2.4 frames for an ID3v2.3 tag. Timestamps are
+// split into the older year, date and time frames: TDRC becomes TYER, TDAT
+// (DDMM) and TIME (HHMM), and TDOR becomes TORY.
+func framesV23(frames []frame) []frame {
+	out := make([]frame, 0, len(frames)+2)
+	text := func(id, v string) {
+		if v != "" {
+			out = append(out, frame{id: id, kind: kindText, values: []string{v}})
+		}
+	}
+
+	for _, f := range frames {
+		switch {
+		case f.kind == kindText && f.id == "TDRC":
+			ts := f.values[0]
+			text("TYER", field(ts, 0, 4))
+			if len(ts) >= 10 {
+				text("TDAT", ts[8:10]+ts[5:7])
+			}
+			if len(ts) >= 16 {
+				text("TIME", ts[11:13]+ts[14:16])
+			}
+		case f.kind == kindText && f.id == "TDOR":
+			text("TORY", field(f.values[0], 0, 4))
+		case framesV24Only[f.id]:
+		default:
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// field returns ts[i:j] of an ID3v2.4 timestamp (yyyy-MM-ddTHH:mm:ss, of
+// which any tail may be missing), or "" if ts is too short.
+func field(ts string, i, j int) string {
+	if len(ts) < j {
+		return ""
+	}
+	return ts[i:j]
+}
@@ -0,0 +1,66 @@
+package id3
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFramesV23(t *testing.T) {
+	tests := []struct {
+		name string
+		text [][]string // frame ID, then value
+		want []string   // frame ID=value
+	}{
+		{
+			name: "full timestamp",
+			text: [][]string{{"TIT2", "Title"}, {"TDRC", "2024-03-07T18:45:12"}, {"TALB", "Album"}},
+			want: []string{"TIT2=Title", "TYER=2024", "TDAT=0703", "TIME=1845", "TALB=Album"},
+		},
+		{
+			name: "date",
+			text: [][]string{{"TDRC", "2024-03-07"}},
+			want: []string{"TYER=2024", "TDAT=0703"},
+		},
+		{
+			name: "month",
+			text: [][]string{{"TDRC", "2024-03"}},
+			want: []string{"TYER=2024"},
+		},
+		{
+			name: "hour",
+			text: [][]string{{"TDRC", "2024-03-07T18"}},
+			want: []string{"TYER=2024", "TDAT=0703"},
+		},
+		{
+			name: "too short for a year",
+			text: [][]string{{"TDRC", "24"}},
+		},
+		{
+			name: "original release",
+			text: [][]string{{"TDOR", "1999-05-01"}},
+			want: []string{"TORY=1999"},
+		},
+		{
+			name: "v2.4 only frames",
+			text: [][]string{{"TSOP", "Artist, The"}, {"TPE1", "The Artist"}, {"TMOO", "Calm"}},
+			want: []string{"TPE1=The Artist"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag := New()
+			for _, f := range tt.text {
+				tag.SetText(f[0], f[1])
+			}
+			var got []string
+			for _, f := range framesV23(tag.frames) {
+				got = append(got, f.id+"="+strings.Join(f.values, "/"))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("framesV23() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
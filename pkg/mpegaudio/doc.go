@@ -0,0 +1,9 @@
+// Package mpegaudio parses MPEG-1, MPEG-2 and MPEG-2.5 audio frame headers for Layers I, II and III.
+//
+// It is used to cut recordings on frame boundaries and to work out their duration:
+//   - ParseHeader decodes a four byte frame header: version, layer, bitrate, sample rate, padding
+//     and channel mode, from which the frame's length, sample count and duration follow
+//   - FindSync only accepts a sync word that is followed by a chain of frames from the same stream,
+//     since 0xFF 0xE? pairs turn up all the time inside compressed audio and tags
+//   - Free-format streams, whose frame length isn't in the header, are not supported
+package mpegaudio
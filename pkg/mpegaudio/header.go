@@ -0,0 +1,255 @@
+package mpegaudio
+
+import (
+	"fmt"
+	"time"
+)
+
+// HeaderLen is the length of a frame header. A CRC, if present, follows it.
+const HeaderLen = 4
+
+// Version is the MPEG audio version.
+type Version int
+
+const (
+	Version1  Version = iota + 1 // MPEG-1
+	Version2                     // MPEG-2 LSF
+	Version25                    // MPEG-2.5, an unofficial extension for very low sample rates
+)
+
+func (v Version) String() string {
+	switch v {
+	case Version1:
+		return "MPEG-1"
+	case Version2:
+		return "MPEG-2"
+	case Version25:
+		return "MPEG-2.5"
+	}
+	return fmt.Sprintf("Version(%d)", int(v))
+}
+
+// Layer is the MPEG audio layer.
+type Layer int
+
+const (
+	Layer1 Layer = iota + 1
+	Layer2
+	Layer3
+)
+
+func (l Layer) String() string {
+	switch l {
+	case Layer1:
+		return "Layer I"
+	case Layer2:
+		return "Layer II"
+	case Layer3:
+		return "Layer III"
+	}
+	return fmt.Sprintf("Layer(%d)", int(l))
+}
+
+// ChannelMode is the channel mode of a frame.
+type ChannelMode int
+
+const (
+	Stereo ChannelMode = iota
+	JointStereo
+	DualChannel
+	Mono
+)
+
+func (m ChannelMode) String() string {
+	switch m {
+	case Stereo:
+		return "stereo"
+	case JointStereo:
+		return "joint stereo"
+	case DualChannel:
+		return "dual channel"
+	case Mono:
+		return "mono"
+	}
+	return fmt.Sprintf("ChannelMode(%d)", int(m))
+}
+
+// Bitrates in kbps by bitrate index, for MPEG-1 and for MPEG-2 and 2.5,
+// which share a table. Index 0 is free format and 15 is invalid.
+var (
+	bitratesV1 = [3][15]int{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448}, // Layer I
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},    // Layer II
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},     // Layer III
+	}
+	bitratesV2 = [3][15]int{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256}, // Layer I
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},      // Layer II
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},      // Layer III
+	}
+)
+
+// Sample rates in Hz by sample rate index; index 3 is reserved.
+var sampleRates = map[Version][3]int{
+	Version1:  {44100, 48000, 32000},
+	Version2:  {22050, 24000, 16000},
+	Version25: {11025, 12000, 8000},
+}
+
+// Header is a decoded frame header.
+type Header struct {
+	Version     Version
+	Layer       Layer
+	CRC         bool // a 16-bit CRC follows the header
+	Bitrate     int  // kbps
+	SampleRate  int  // Hz
+	Padding     bool // the frame has one extra slot
+	ChannelMode ChannelMode
+	ModeExt     int
+	Copyright   bool
+	Original    bool
+	Emphasis    int
+}
+
+// ParseHeader decodes the frame header at the start of b. It returns false
+// if b is shorter than HeaderLen or doesn't start with a valid header: a
+// sync word followed by a version, layer, bitrate, sample rate and emphasis
+// that aren't reserved. Free-format frames are rejected too.
+func ParseHeader(b []byte) (Header, bool) {
+	if len(b) < HeaderLen || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return Header{}, false
+	}
+
+	var h Header
+	switch (b[1] >> 3) & 0x03 {
+	case 0:
+		h.Version = Version25
+	case 2:
+		h.Version = Version2
+	case 3:
+		h.Version = Version1
+	default:
+		return Header{}, false
+	}
+	switch (b[1] >> 1) & 0x03 {
+	case 1:
+		h.Layer = Layer3
+	case 2:
+		h.Layer = Layer2
+	case 3:
+		h.Layer = Layer1
+	default:
+		return Header{}, false
+	}
+	h.CRC = b[1]&0x01 == 0
+
+	bitrateIndex := int(b[2] >> 4)
+	sampleRateIndex := int(b[2]>>2) & 0x03
+	if bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return Header{}, false
+	}
+	if h.Version == Version1 {
+		h.Bitrate = bitratesV1[h.Layer-1][bitrateIndex]
+	} else {
+		h.Bitrate = bitratesV2[h.Layer-1][bitrateIndex]
+	}
+	h.SampleRate = sampleRates[h.Version][sampleRateIndex]
+	h.Padding = b[2]&0x02 != 0
+
+	h.ChannelMode = ChannelMode(b[3] >> 6)
+	h.ModeExt = int(b[3]>>4) & 0x03
+	h.Copyright = b[3]&0x08 != 0
+	h.Original = b[3]&0x04 != 0
+	h.Emphasis = int(b[3] & 0x03)
+	if h.Emphasis == 2 {
+		return Header{}, false
+	}
+
+	return h, true
+}
+
+// Samples returns the number of samples per channel in the frame.
+func (h Header) Samples() int {
+	switch {
+	case h.Layer == Layer1:
+		return 384
+	case h.Layer == Layer3 && h.Version != Version1:
+		return 576
+	}
+	return 1152
+}
+
+// FrameLen returns the length of the frame in bytes, including the header.
+func (h Header) FrameLen() int {
+	if h.Layer == Layer1 {
+		n := 12 * h.Bitrate * 1000 / h.SampleRate
+		if h.Padding {
+			n++
+		}
+		return n * 4
+	}
+
+	// Samples/8 bytes per kbit/s of bitrate and Hz of sample rate.
+	n := h.Samples() / 8 * h.Bitrate * 1000 / h.SampleRate
+	if h.Padding {
+		n++
+	}
+	return n
+}
+
+// Duration returns how long the frame plays for.
+func (h Header) Duration() time.Duration {
+	return time.Duration(h.Samples()) * time.Second / time.Duration(h.SampleRate)
+}
+
+// Channels returns the number of audio channels.
+func (h Header) Channels() int {
+	if h.ChannelMode == Mono {
+		return 1
+	}
+	return 2
+}
+
+// SameStream reports whether o can follow h in the same stream. The
+// bitrate changes from frame to frame in VBR streams, and the channel mode
+// may switch between stereo and joint stereo, so neither is compared beyond
+// the channel count.
+func (h Header) SameStream(o Header) bool {
+	return h.Version == o.Version && h.Layer == o.Layer &&
+		h.SampleRate == o.SampleRate && h.Channels() == o.Channels()
+}
+
+// FindSync returns the offset of the first frame in b that is followed by
+// at least chain-1 more frames of the same stream, each starting where the
+// previous one ends. It returns -1 if there is none; b may just be too
+// short to hold the whole chain.
+func FindSync(b []byte, chain int) int {
+	for i := 0; i+HeaderLen <= len(b); i++ {
+		if b[i] != 0xFF {
+			continue
+		}
+		h, ok := ParseHeader(b[i:])
+		if !ok {
+			continue
+		}
+		if chained(b[i:], h, chain) {
+			return i
+		}
+	}
+	return -1
+}
+
+// chained reports whether the frame h at the start of b is followed by
+// chain-1 frames of the same stream.
+func chained(b []byte, h Header, chain int) bool {
+	off := 0
+	for n := 1; n < chain; n++ {
+		off += h.FrameLen()
+		next, ok := ParseHeader(b[min(off, len(b)):])
+		if !ok || !h.SameStream(next) {
+			return false
+		}
+		h = next
+	}
+	return true
+}
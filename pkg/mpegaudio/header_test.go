@@ -0,0 +1,156 @@
+package mpegaudio
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want Header
+	}{
+		{
+			name: "MPEG-1 Layer III",
+			b:    []byte{0xFF, 0xFB, 0x90, 0x64},
+			want: Header{Version: Version1, Layer: Layer3, Bitrate: 128, SampleRate: 44100, ChannelMode: JointStereo, ModeExt: 2, Original: true},
+		},
+		{
+			name: "MPEG-1 Layer III with CRC and padding",
+			b:    []byte{0xFF, 0xFA, 0xE6, 0xC0},
+			want: Header{Version: Version1, Layer: Layer3, CRC: true, Bitrate: 320, SampleRate: 48000, Padding: true, ChannelMode: Mono},
+		},
+		{
+			name: "MPEG-2 Layer III",
+			b:    []byte{0xFF, 0xF3, 0x80, 0x00},
+			want: Header{Version: Version2, Layer: Layer3, Bitrate: 64, SampleRate: 22050, ChannelMode: Stereo},
+		},
+		{
+			name: "MPEG-2.5 Layer III",
+			b:    []byte{0xFF, 0xE3, 0x18, 0xC0},
+			want: Header{Version: Version25, Layer: Layer3, Bitrate: 8, SampleRate: 8000, ChannelMode: Mono},
+		},
+		{
+			name: "MPEG-1 Layer II",
+			b:    []byte{0xFF, 0xFD, 0xA4, 0x0C},
+			want: Header{Version: Version1, Layer: Layer2, Bitrate: 192, SampleRate: 48000, ChannelMode: Stereo, Copyright: true, Original: true},
+		},
+		{
+			name: "MPEG-1 Layer I",
+			b:    []byte{0xFF, 0xFF, 0x18, 0x81},
+			want: Header{Version: Version1, Layer: Layer1, Bitrate: 32, SampleRate: 32000, ChannelMode: DualChannel, Emphasis: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, ok := ParseHeader(tt.b)
+			if !ok {
+				t.Fatalf("ParseHeader(% X) failed", tt.b)
+			}
+			if h != tt.want {
+				t.Errorf("ParseHeader(% X) = %+v, want %+v", tt.b, h, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHeaderInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"short", []byte{0xFF, 0xFB, 0x90}},
+		{"no sync", []byte{0xFE, 0xFB, 0x90, 0x64}},
+		{"short sync", []byte{0xFF, 0xDB, 0x90, 0x64}},
+		{"reserved version", []byte{0xFF, 0xEB, 0x90, 0x64}},
+		{"reserved layer", []byte{0xFF, 0xF9, 0x90, 0x64}},
+		{"ADTS", []byte{0xFF, 0xF1, 0x50, 0x80}},
+		{"free format", []byte{0xFF, 0xFB, 0x00, 0x64}},
+		{"bad bitrate", []byte{0xFF, 0xFB, 0xF0, 0x64}},
+		{"reserved sample rate", []byte{0xFF, 0xFB, 0x9C, 0x64}},
+		{"reserved emphasis", []byte{0xFF, 0xFB, 0x90, 0x66}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if h, ok := ParseHeader(tt.b); ok {
+				t.Errorf("ParseHeader(% X) = %+v, want failure", tt.b, h)
+			}
+		})
+	}
+}
+
+func TestFrameLen(t *testing.T) {
+	tests := []struct {
+		h        Header
+		len      int
+		samples  int
+		duration time.Duration
+	}{
+		{Header{Version: Version1, Layer: Layer3, Bitrate: 128, SampleRate: 44100}, 417, 1152, 26122448 * time.Nanosecond},
+		{Header{Version: Version1, Layer: Layer3, Bitrate: 128, SampleRate: 44100, Padding: true}, 418, 1152, 26122448 * time.Nanosecond},
+		{Header{Version: Version1, Layer: Layer3, Bitrate: 320, SampleRate: 48000}, 960, 1152, 24 * time.Millisecond},
+		{Header{Version: Version1, Layer: Layer3, Bitrate: 32, SampleRate: 32000}, 144, 1152, 36 * time.Millisecond},
+		{Header{Version: Version2, Layer: Layer3, Bitrate: 64, SampleRate: 22050}, 208, 576, 26122448 * time.Nanosecond},
+		{Header{Version: Version2, Layer: Layer3, Bitrate: 160, SampleRate: 24000}, 480, 576, 24 * time.Millisecond},
+		{Header{Version: Version25, Layer: Layer3, Bitrate: 8, SampleRate: 8000}, 72, 576, 72 * time.Millisecond},
+		{Header{Version: Version1, Layer: Layer2, Bitrate: 192, SampleRate: 48000}, 576, 1152, 24 * time.Millisecond},
+		{Header{Version: Version2, Layer: Layer2, Bitrate: 64, SampleRate: 24000}, 384, 1152, 48 * time.Millisecond},
+		{Header{Version: Version1, Layer: Layer1, Bitrate: 32, SampleRate: 32000}, 48, 384, 12 * time.Millisecond},
+		{Header{Version: Version1, Layer: Layer1, Bitrate: 448, SampleRate: 44100, Padding: true}, 488, 384, 8707482 * time.Nanosecond},
+	}
+
+	for _, tt := range tests {
+		if n := tt.h.FrameLen(); n != tt.len {
+			t.Errorf("%+v: FrameLen() = %d, want %d", tt.h, n, tt.len)
+		}
+		if n := tt.h.Samples(); n != tt.samples {
+			t.Errorf("%+v: Samples() = %d, want %d", tt.h, n, tt.samples)
+		}
+		if d := tt.h.Duration(); d != tt.duration {
+			t.Errorf("%+v: Duration() = %v, want %v", tt.h, d, tt.duration)
+		}
+	}
+}
+
+// frames returns n frames of the stream with the given header, with zero
+// payload.
+func frames(hdr []byte, n int) []byte {
+	h, _ := ParseHeader(hdr)
+	frame := make([]byte, h.FrameLen())
+	copy(frame, hdr)
+	return bytes.Repeat(frame, n)
+}
+
+func TestFindSync(t *testing.T) {
+	cbr := frames([]byte{0xFF, 0xFB, 0x90, 0x64}, 4)
+	vbr := append(frames([]byte{0xFF, 0xFB, 0x90, 0x64}, 1), frames([]byte{0xFF, 0xFB, 0xB0, 0x44}, 2)...)
+	resampled := append(frames([]byte{0xFF, 0xFB, 0x90, 0x64}, 1), frames([]byte{0xFF, 0xFB, 0x94, 0x64}, 3)...)
+
+	tests := []struct {
+		name  string
+		b     []byte
+		chain int
+		want  int
+	}{
+		{"start", cbr, 3, 0},
+		{"mid-frame", cbr[100:], 3, 317},
+		{"garbage first", append([]byte{0xFF, 0xFB, 0x90, 0x64, 1, 2, 3}, cbr...), 3, 7},
+		{"too short for the chain", cbr[:417*2], 3, -1},
+		{"single frame", cbr[:417], 1, 0},
+		{"bitrate changes", vbr, 3, 0},
+		{"sample rate changes", resampled, 3, 417},
+		{"nothing", make([]byte, 1000), 1, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FindSync(tt.b, tt.chain); got != tt.want {
+				t.Errorf("FindSync() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
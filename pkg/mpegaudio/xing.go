@@ -0,0 +1,199 @@
+package mpegaudio
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Xing header flags.
+const (
+	xingFrames = 1 << iota
+	xingBytes
+	xingTOC
+	xingQuality
+)
+
+const (
+	xingTagVBR = "Xing"
+	xingTagCBR = "Info"
+)
+
+// Xing is the content of a Xing or Info header: a Layer III frame without
+// audio at the start of a file that gives its length, so players needn't
+// guess the duration from the first frame's bitrate, and a table for
+// seeking. Encoders write "Xing" for VBR and "Info" for CBR files.
+type Xing struct {
+	VBR    bool
+	Frames int // audio frames, not counting the Xing frame
+	Bytes  int // length of the audio including the Xing frame
+
+	// TOC maps each percent of the duration to the byte position it starts
+	// at, in 256ths of Bytes.
+	TOC [100]byte
+}
+
+// Frame encodes x as a frame for the stream h belongs to. The frame has
+// h's version, sample rate and channel mode, no CRC and no padding, and the
+// bitrate of h if the header fits in such a frame, otherwise the lowest one
+// it fits in. Its length therefore only depends on h, so a placeholder can
+// be written first and overwritten once the counts are known. It returns
+// false unless h is Layer III.
+func (x Xing) Frame(h Header) ([]byte, bool) {
+	if h.Layer != Layer3 {
+		return nil, false
+	}
+	h.CRC, h.Padding = false, false
+
+	offset := HeaderLen + sideInfoLen(h)
+	need := offset + 4 + 4 + 4 + 4 + len(x.TOC)
+	table := bitratesV2[Layer3-1]
+	if h.Version == Version1 {
+		table = bitratesV1[Layer3-1]
+	}
+	for i := 1; h.FrameLen() < need; i++ {
+		if i == len(table) {
+			return nil, false
+		}
+		h.Bitrate = table[i]
+	}
+
+	hdr, ok := h.encode()
+	if !ok {
+		return nil, false
+	}
+	frame := make([]byte, h.FrameLen())
+	copy(frame, hdr[:])
+
+	b := frame[offset:]
+	if x.VBR {
+		copy(b, xingTagVBR)
+	} else {
+		copy(b, xingTagCBR)
+	}
+	binary.BigEndian.PutUint32(b[4:], xingFrames|xingBytes|xingTOC)
+	binary.BigEndian.PutUint32(b[8:], uint32(x.Frames))
+	binary.BigEndian.PutUint32(b[12:], uint32(x.Bytes))
+	copy(b[16:], x.TOC[:])
+
+	return frame, true
+}
+
+// ParseXing reads the Xing or Info header in frame, which must start with
+// the frame header. It returns false if there is none.
+func ParseXing(frame []byte) (Xing, bool) {
+	h, ok := ParseHeader(frame)
+	if !ok || h.Layer != Layer3 {
+		return Xing{}, false
+	}
+	offset := HeaderLen + sideInfoLen(h)
+	if h.CRC {
+		offset += 2
+	}
+	if len(frame) < offset+8 {
+		return Xing{}, false
+	}
+
+	var x Xing
+	b := frame[offset:]
+	switch {
+	case bytes.HasPrefix(b, []byte(xingTagVBR)):
+		x.VBR = true
+	case bytes.HasPrefix(b, []byte(xingTagCBR)):
+	default:
+		return Xing{}, false
+	}
+	flags := binary.BigEndian.Uint32(b[4:])
+	b = b[8:]
+	if flags&xingFrames != 0 {
+		if len(b) < 4 {
+			return Xing{}, false
+		}
+		x.Frames = int(binary.BigEndian.Uint32(b))
+		b = b[4:]
+	}
+	if flags&xingBytes != 0 {
+		if len(b) < 4 {
+			return Xing{}, false
+		}
+		x.Bytes = int(binary.BigEndian.Uint32(b))
+		b = b[4:]
+	}
+	if flags&xingTOC != 0 {
+		if len(b) < len(x.TOC) {
+			return Xing{}, false
+		}
+		copy(x.TOC[:], b)
+	}
+	return x, true
+}
+
+// sideInfoLen returns the length of the Layer III side information that
+// follows the header (and CRC), where the Xing header goes.
+func sideInfoLen(h Header) int {
+	switch {
+	case h.Version == Version1 && h.ChannelMode == Mono:
+		return 17
+	case h.Version == Version1:
+		return 32
+	case h.ChannelMode == Mono:
+		return 9
+	}
+	return 17
+}
+
+// encode returns the four header bytes for h.
+func (h Header) encode() ([HeaderLen]byte, bool) {
+	var b [HeaderLen]byte
+
+	var version, layer byte
+	switch h.Version {
+	case Version1:
+		version = 3
+	case Version2:
+		version = 2
+	case Version25:
+		version = 0
+	default:
+		return b, false
+	}
+	layer = byte(4 - h.Layer)
+
+	table := bitratesV2[h.Layer-1]
+	if h.Version == Version1 {
+		table = bitratesV1[h.Layer-1]
+	}
+	bitrateIndex := -1
+	for i, br := range table[1:] {
+		if br == h.Bitrate {
+			bitrateIndex = i + 1
+			break
+		}
+	}
+	sampleRateIndex := -1
+	for i, sr := range sampleRates[h.Version] {
+		if sr == h.SampleRate {
+			sampleRateIndex = i
+		}
+	}
+	if bitrateIndex < 0 || sampleRateIndex < 0 {
+		return b, false
+	}
+
+	b[0] = 0xFF
+	b[1] = 0xE0 | version<<3 | layer<<1
+	if !h.CRC {
+		b[1] |= 0x01
+	}
+	b[2] = byte(bitrateIndex)<<4 | byte(sampleRateIndex)<<2
+	if h.Padding {
+		b[2] |= 0x02
+	}
+	b[3] = byte(h.ChannelMode)<<6 | byte(h.ModeExt&0x03)<<4 | byte(h.Emphasis&0x03)
+	if h.Copyright {
+		b[3] |= 0x08
+	}
+	if h.Original {
+		b[3] |= 0x04
+	}
+	return b, true
+}
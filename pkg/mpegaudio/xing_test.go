@@ -0,0 +1,100 @@
+package mpegaudio
+
+import "testing"
+
+func TestSideInfoLen(t *testing.T) {
+	tests := []struct {
+		version Version
+		mode    ChannelMode
+		want    int
+	}{
+		{Version1, Stereo, 32},
+		{Version1, JointStereo, 32},
+		{Version1, DualChannel, 32},
+		{Version1, Mono, 17},
+		{Version2, Stereo, 17},
+		{Version2, Mono, 9},
+		{Version25, JointStereo, 17},
+		{Version25, Mono, 9},
+	}
+
+	for _, tt := range tests {
+		h := Header{Version: tt.version, Layer: Layer3, ChannelMode: tt.mode}
+		if got := sideInfoLen(h); got != tt.want {
+			t.Errorf("sideInfoLen(%v %v) = %d, want %d", tt.version, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestXingRoundTrip(t *testing.T) {
+	var toc [100]byte
+	for i := range toc {
+		toc[i] = byte(i * 256 / 100)
+	}
+
+	tests := []struct {
+		name    string
+		h       Header
+		wantLen int
+	}{
+		{
+			name:    "MPEG-1 stereo",
+			h:       Header{Version: Version1, Layer: Layer3, Bitrate: 128, SampleRate: 44100, ChannelMode: JointStereo},
+			wantLen: 417,
+		},
+		{
+			name:    "MPEG-1 mono with CRC and padding",
+			h:       Header{Version: Version1, Layer: Layer3, CRC: true, Bitrate: 64, SampleRate: 48000, Padding: true, ChannelMode: Mono},
+			wantLen: 192,
+		},
+		{
+			// 8 kbps frames are too short for the header, so the bitrate
+			// is raised until it fits.
+			name:    "MPEG-2.5 at the lowest bitrate",
+			h:       Header{Version: Version25, Layer: Layer3, Bitrate: 8, SampleRate: 8000, ChannelMode: Mono},
+			wantLen: 144,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, vbr := range []bool{false, true} {
+			x := Xing{VBR: vbr, Frames: 12345, Bytes: 6789012, TOC: toc}
+			frame, ok := x.Frame(tt.h)
+			if !ok {
+				t.Fatalf("%s: Frame failed", tt.name)
+			}
+			if len(frame) != tt.wantLen {
+				t.Errorf("%s: frame is %d bytes, want %d", tt.name, len(frame), tt.wantLen)
+			}
+
+			h, ok := ParseHeader(frame)
+			if !ok {
+				t.Fatalf("%s: frame doesn't start with a valid header", tt.name)
+			}
+			if !h.SameStream(tt.h) || h.CRC || h.Padding || h.FrameLen() != len(frame) {
+				t.Errorf("%s: frame header %+v doesn't match %+v", tt.name, h, tt.h)
+			}
+
+			got, ok := ParseXing(frame)
+			if !ok {
+				t.Fatalf("%s: ParseXing failed", tt.name)
+			}
+			if got != x {
+				t.Errorf("%s: ParseXing() = %+v, want %+v", tt.name, got, x)
+			}
+		}
+	}
+}
+
+func TestXingFrameNotLayer3(t *testing.T) {
+	h := Header{Version: Version1, Layer: Layer2, Bitrate: 192, SampleRate: 48000}
+	if _, ok := (Xing{}).Frame(h); ok {
+		t.Error("Frame succeeded for Layer II")
+	}
+}
+
+func TestParseXingAudioFrame(t *testing.T) {
+	if x, ok := ParseXing(frames([]byte{0xFF, 0xFB, 0x90, 0x64}, 1)); ok {
+		t.Errorf("ParseXing() = %+v for an audio frame", x)
+	}
+}
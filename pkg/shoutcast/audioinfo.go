@@ -0,0 +1,82 @@
+package shoutcast
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// AudioInfo describes the encoding of a stream as announced by the server.
+// Zero values mean the server didn't say.
+type AudioInfo struct {
+	SampleRate int // Hz
+	Channels   int
+	Bitrate    int // kbps
+	Quality    string
+
+	// Fields holds every key of the ice-audio-info header, with any "ice-"
+	// prefix removed.
+	Fields map[string]string
+}
+
+// parseAudioInfo parses an ice-audio-info (or icy-audio-info) value such as
+// "ice-samplerate=44100;ice-bitrate=128;ice-channels=2". Some servers URL
+// encode the separators, others leave out the "ice-" prefixes.
+func parseAudioInfo(v string) AudioInfo {
+	info := AudioInfo{Fields: make(map[string]string)}
+
+	if decoded, err := url.QueryUnescape(v); err == nil {
+		v = decoded
+	}
+	for _, pair := range strings.Split(v, ";") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(key)), "ice-")
+		value = strings.TrimSpace(value)
+		if key == "" {
+			continue
+		}
+		info.Fields[key] = value
+
+		switch key {
+		case "samplerate":
+			info.SampleRate, _ = strconv.Atoi(value)
+		case "channels":
+			info.Channels, _ = strconv.Atoi(value)
+		case "bitrate":
+			info.Bitrate, _ = strconv.Atoi(value)
+		case "quality":
+			info.Quality = value
+		}
+	}
+
+	return info
+}
+
+// audioInfoFromHeader combines ice-audio-info with the older icy-sr,
+// icy-channels and icy-br headers, which take effect where the former is
+// silent.
+func audioInfoFromHeader(header http.Header) AudioInfo {
+	raw := header.Get("ice-audio-info")
+	if raw == "" {
+		raw = header.Get("icy-audio-info")
+	}
+	info := parseAudioInfo(raw)
+
+	if info.SampleRate == 0 {
+		info.SampleRate, _ = strconv.Atoi(strings.TrimSpace(header.Get("icy-sr")))
+	}
+	if info.Channels == 0 {
+		info.Channels, _ = strconv.Atoi(strings.TrimSpace(header.Get("icy-channels")))
+	}
+	if info.Bitrate == 0 {
+		// icy-br is sometimes "128,128" for the nominal and maximum rate.
+		br, _, _ := strings.Cut(header.Get("icy-br"), ",")
+		info.Bitrate, _ = strconv.Atoi(strings.TrimSpace(br))
+	}
+
+	return info
+}
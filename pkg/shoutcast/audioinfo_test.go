@@ -0,0 +1,129 @@
+package shoutcast
+
+import (
+	"maps"
+	"net/http"
+	"testing"
+)
+
+func TestParseAudioInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		v    string
+		want AudioInfo
+	}{
+		{
+			name: "icecast",
+			v:    "ice-samplerate=44100;ice-bitrate=128;ice-channels=2",
+			want: AudioInfo{SampleRate: 44100, Channels: 2, Bitrate: 128,
+				Fields: map[string]string{"samplerate": "44100", "bitrate": "128", "channels": "2"}},
+		},
+		{
+			name: "url encoded",
+			v:    "ice-samplerate%3D48000%3Bice-bitrate%3D320%3Bice-channels%3D2%3Bice-quality%3D10%2E0",
+			want: AudioInfo{SampleRate: 48000, Channels: 2, Bitrate: 320, Quality: "10.0",
+				Fields: map[string]string{"samplerate": "48000", "bitrate": "320", "channels": "2", "quality": "10.0"}},
+		},
+		{
+			name: "without prefixes",
+			v:    "channels=1;samplerate=22050;bitrate=64",
+			want: AudioInfo{SampleRate: 22050, Channels: 1, Bitrate: 64,
+				Fields: map[string]string{"samplerate": "22050", "bitrate": "64", "channels": "1"}},
+		},
+		{
+			name: "mixed case and space",
+			v:    " ICE-Bitrate = 96 ; ice-Channels=2;",
+			want: AudioInfo{Channels: 2, Bitrate: 96,
+				Fields: map[string]string{"bitrate": "96", "channels": "2"}},
+		},
+		{
+			name: "unknown keys and junk",
+			v:    "ice-samplerate=x;ice-codec=opus;novalue;=5",
+			want: AudioInfo{Fields: map[string]string{"samplerate": "x", "codec": "opus"}},
+		},
+		{
+			name: "literal percent",
+			v:    "ice-quality=100%;ice-bitrate=128",
+			want: AudioInfo{Bitrate: 128, Quality: "100%",
+				Fields: map[string]string{"quality": "100%", "bitrate": "128"}},
+		},
+		{
+			name: "empty",
+			want: AudioInfo{Fields: map[string]string{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseAudioInfo(tt.v)
+			if !equalAudioInfo(got, tt.want) {
+				t.Errorf("parseAudioInfo(%q) = %+v, want %+v", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAudioInfoFromHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   AudioInfo
+	}{
+		{
+			name: "ice-audio-info wins",
+			header: map[string]string{
+				"ice-audio-info": "ice-samplerate=44100;ice-bitrate=128;ice-channels=2",
+				"icy-sr":         "22050",
+				"icy-br":         "64",
+				"icy-channels":   "1",
+			},
+			want: AudioInfo{SampleRate: 44100, Channels: 2, Bitrate: 128},
+		},
+		{
+			name:   "icy-audio-info",
+			header: map[string]string{"icy-audio-info": "ice-samplerate=32000"},
+			want:   AudioInfo{SampleRate: 32000},
+		},
+		{
+			name: "fallbacks fill the gaps",
+			header: map[string]string{
+				"ice-audio-info": "ice-bitrate=128",
+				"icy-sr":         " 48000 ",
+				"icy-br":         "64",
+				"icy-channels":   "2",
+			},
+			want: AudioInfo{SampleRate: 48000, Channels: 2, Bitrate: 128},
+		},
+		{
+			name:   "nominal and maximum bitrate",
+			header: map[string]string{"icy-br": "128,128"},
+			want:   AudioInfo{Bitrate: 128},
+		},
+		{
+			name:   "unparsable fallbacks",
+			header: map[string]string{"icy-sr": "44.1k", "icy-br": "", "icy-channels": "stereo"},
+		},
+		{
+			name: "nothing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := make(http.Header)
+			for k, v := range tt.header {
+				h.Set(k, v)
+			}
+			got := audioInfoFromHeader(h)
+			got.Fields = nil
+			if !equalAudioInfo(got, tt.want) {
+				t.Errorf("audioInfoFromHeader() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func equalAudioInfo(a, b AudioInfo) bool {
+	return a.SampleRate == b.SampleRate && a.Channels == b.Channels && a.Bitrate == b.Bitrate &&
+		a.Quality == b.Quality && maps.Equal(a.Fields, b.Fields)
+}
@@ -0,0 +1,116 @@
+package shoutcast
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// DefaultCharset is used to decode metadata that isn't valid UTF-8 when no
+// other charset is configured. Windows-1252 is a superset of the printable
+// ISO-8859-1 range, so it is the safest guess for European stations.
+const DefaultCharset = "windows-1252"
+
+// charsets are the legacy encodings metadata can be decoded from, by name
+// and alias. Only single-byte encodings are offered: a fallback is applied
+// to text that failed to be UTF-8, and a multi-byte guess would turn one
+// broken title into another.
+var charsets = map[string]*charmap.Charmap{
+	"iso-8859-1":   charmap.ISO8859_1,
+	"iso8859-1":    charmap.ISO8859_1,
+	"latin1":       charmap.ISO8859_1,
+	"windows-1252": charmap.Windows1252,
+	"cp1252":       charmap.Windows1252,
+	"iso-8859-15":  charmap.ISO8859_15,
+	"iso8859-15":   charmap.ISO8859_15,
+	"latin9":       charmap.ISO8859_15,
+}
+
+// SupportedCharset reports whether name is a charset metadata can be decoded
+// from. "utf-8" is always supported.
+func SupportedCharset(name string) bool {
+	_, err := lookupCharset(name)
+	return err == nil
+}
+
+// lookupCharset returns the charset called name. A nil charset means UTF-8.
+func lookupCharset(name string) (*charmap.Charmap, error) {
+	n := strings.ToLower(strings.TrimSpace(name))
+	switch n {
+	case "utf-8", "utf8":
+		return nil, nil
+	}
+	cs, ok := charsets[n]
+	if !ok {
+		return nil, fmt.Errorf("unsupported charset %q", name)
+	}
+	return cs, nil
+}
+
+// decodeCharset converts s from cs to UTF-8. A nil cs means s is UTF-8
+// already, and only invalid sequences are replaced.
+func decodeCharset(cs *charmap.Charmap, s string) string {
+	if cs == nil {
+		return strings.ToValidUTF8(s, string(utf8.RuneError))
+	}
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < utf8.RuneSelf {
+			sb.WriteByte(c)
+		} else {
+			sb.WriteRune(cs.DecodeByte(c))
+		}
+	}
+	return sb.String()
+}
+
+// defaultTextDecoder is used by NewMetadata.
+var defaultTextDecoder = &textDecoder{fallback: charsets[DefaultCharset]}
+
+// textDecoder turns raw metadata and header text into valid UTF-8.
+type textDecoder struct {
+	// fallback decodes text that isn't valid UTF-8.
+	fallback *charmap.Charmap
+	// forced, when set, decodes all text regardless of whether it is valid
+	// UTF-8. It comes from a charset announced by the server.
+	forced    *charmap.Charmap
+	hasForced bool
+}
+
+// newTextDecoder returns a decoder for the configured fallback charset.
+func newTextDecoder(fallback string) (*textDecoder, error) {
+	cs, err := lookupCharset(fallback)
+	if err != nil {
+		return nil, err
+	}
+	return &textDecoder{fallback: cs}, nil
+}
+
+// withServerCharset returns a copy of d that decodes everything as the
+// charset announced by the server. Unknown charsets are ignored.
+func (d *textDecoder) withServerCharset(name string) *textDecoder {
+	if name == "" {
+		return d
+	}
+	cs, err := lookupCharset(name)
+	if err != nil {
+		return d
+	}
+	return &textDecoder{fallback: d.fallback, forced: cs, hasForced: true}
+}
+
+func (d *textDecoder) decode(s string) string {
+	if d == nil {
+		return decodeCharset(nil, s)
+	}
+	if d.hasForced {
+		return decodeCharset(d.forced, s)
+	}
+	if utf8.ValidString(s) {
+		return s
+	}
+	return decodeCharset(d.fallback, s)
+}
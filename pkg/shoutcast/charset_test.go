@@ -0,0 +1,72 @@
+package shoutcast
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTextDecoder(t *testing.T) {
+	tests := []struct {
+		name          string
+		fallback      string
+		serverCharset string
+		in            string
+		want          string
+	}{
+		{"utf-8 passes through", DefaultCharset, "", "Café – Motörhead", "Café – Motörhead"},
+		{"ascii passes through", "iso-8859-1", "", "Artist - Title", "Artist - Title"},
+		{"windows-1252 fallback", DefaultCharset, "", "Caf\xe9 \x93live\x94 \x80", "Café “live” €"},
+		{"windows-1252 undefined bytes", "cp1252", "", "\x81\x8d\x8f\x90\x9d", "�����"},
+		{"latin1 fallback", "latin1", "", "Caf\xe9 \x80 \xa4", "Café \u0080 ¤"},
+		{"latin9 fallback", "iso-8859-15", "", "Caf\xe9 \xa4 \xbd", "Café € œ"},
+		{"utf-8 replaces invalid bytes", "utf-8", "", "Caf\xe9", "Caf�"},
+		{"server charset decodes valid utf-8", "utf-8", "latin1", "CafÃ©", "CafÃ\u0083Â©"},
+		{"server charset over fallback", "latin1", "windows-1252", "\x80", "€"},
+		{"unknown server charset ignored", DefaultCharset, "koi8-r", "Caf\xe9", "Café"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOptions(WithMetadataCharset(tt.fallback), WithServerCharset(true))
+			header := http.Header{}
+			if tt.serverCharset != "" {
+				header.Set("icy-metadata-charset", tt.serverCharset)
+			}
+
+			d, err := o.textDecoder(header)
+			if err != nil {
+				t.Fatalf("textDecoder: %v", err)
+			}
+			if got := d.decode(tt.in); got != tt.want {
+				t.Errorf("decode(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerCharsetDisabled(t *testing.T) {
+	header := http.Header{"Icy-Metadata-Charset": {"iso-8859-1"}}
+	d, err := newOptions().textDecoder(header)
+	if err != nil {
+		t.Fatalf("textDecoder: %v", err)
+	}
+	if got := d.decode("Café"); got != "Café" {
+		t.Errorf("decode() = %q, want the UTF-8 text unchanged", got)
+	}
+}
+
+func TestSupportedCharset(t *testing.T) {
+	for _, name := range []string{"utf-8", "UTF8", "windows-1252", "cp1252", " ISO-8859-1 ", "latin1", "iso-8859-15", "latin9"} {
+		if !SupportedCharset(name) {
+			t.Errorf("SupportedCharset(%q) = false, want true", name)
+		}
+	}
+	for _, name := range []string{"", "koi8-r", "shift_jis"} {
+		if SupportedCharset(name) {
+			t.Errorf("SupportedCharset(%q) = true, want false", name)
+		}
+	}
+	if _, err := newTextDecoder("ebcdic"); err == nil {
+		t.Error("newTextDecoder() of an unsupported charset succeeded")
+	}
+}
@@ -1,7 +1,17 @@
 // Package shoutcast provides ICY/Shoutcast stream reading with metadata stripping and playlist resolution.
 //
 // It is a fork of github.com/romantomjak/shoutcast, extended for stream recording:
-//   - Playlist resolution: .pls and .m3u URLs are resolved to the actual stream URL
+//   - Playlist resolution: PLS, M3U, XSPF and ASX playlists, including relative and nested ones, are
+//     resolved to every stream they list, and Open fails over through them until one connects
 //   - Correct metadata stripping: ICY metadata blocks are read and skipped so only audio bytes are returned
 //   - No client timeout on the stream so long-running recording is supported
+//   - Metadata blocks are fully parsed: every key is kept and quoted values may contain ';', '=' and quotes
+//   - Metadata and icy-* header text is always returned as UTF-8; legacy charsets are transcoded
+//   - Passthrough mode for servers that send no icy-metaint, so plain HTTP audio can be read too
+//   - Legacy SHOUTcast v1 servers answering "ICY 200 OK" are read over a raw connection
+//   - HLS (m3u8) sources are polled segment by segment and read as one continuous stream
+//   - Every response header is kept, with the content type, server and ice-audio-info parsed
+//   - Typed errors (StatusError, NotStreamError, PlaylistEmptyError, TLSError, DNSError) tell permanent
+//     failures from transient ones; see IsPermanent and RetryAfter
+//   - Context-aware: OpenContext binds the connection to a context, so cancelling it aborts any in-flight read
 package shoutcast
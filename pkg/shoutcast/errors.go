@@ -0,0 +1,169 @@
+package shoutcast
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusError is returned when the server answers with a status other than
+// 200 OK.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+
+	// RetryAfter is the delay requested by a Retry-After header, as sent
+	// with 503 and 429 responses. Zero if there was none.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %q from %s", e.Status, e.URL)
+}
+
+// NotStreamError is returned when a URL answers but serves neither audio
+// nor a playlist, typically an HTML error or landing page.
+type NotStreamError struct {
+	URL         string
+	ContentType string
+}
+
+func (e *NotStreamError) Error() string {
+	return fmt.Sprintf("%s does not appear to be a stream or playlist (Content-Type: %s)", e.URL, e.ContentType)
+}
+
+// PlaylistEmptyError is returned when a playlist lists no usable stream.
+type PlaylistEmptyError struct {
+	URL    string
+	Format string
+}
+
+func (e *PlaylistEmptyError) Error() string {
+	if e.URL == "" {
+		return fmt.Sprintf("no stream URL found in %s playlist", e.Format)
+	}
+	return fmt.Sprintf("no stream URL found in %s playlist %s", e.Format, e.URL)
+}
+
+// TLSError wraps a failed TLS handshake or certificate verification.
+type TLSError struct {
+	URL string
+	Err error
+}
+
+func (e *TLSError) Error() string {
+	return fmt.Sprintf("TLS error for %s: %v", e.URL, e.Err)
+}
+
+func (e *TLSError) Unwrap() error { return e.Err }
+
+// DNSError wraps a failure to resolve the server's host name.
+type DNSError struct {
+	URL string
+	Err *net.DNSError
+}
+
+func (e *DNSError) Error() string {
+	return fmt.Sprintf("DNS error for %s: %v", e.URL, e.Err)
+}
+
+func (e *DNSError) Unwrap() error { return e.Err }
+
+// IsPermanent reports whether err is unlikely to go away by retrying soon:
+// a 4xx status other than 408 and 429, a URL that isn't a stream, an empty
+// playlist, a TLS certificate problem or a host name that doesn't exist.
+func IsPermanent(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		switch se.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return false
+		}
+		return se.StatusCode >= 400 && se.StatusCode < 500
+	}
+
+	var ne *NotStreamError
+	var pe *PlaylistEmptyError
+	var te *TLSError
+	if errors.As(err, &ne) || errors.As(err, &pe) || errors.As(err, &te) {
+		return true
+	}
+
+	var de *DNSError
+	if errors.As(err, &de) {
+		return de.Err.IsNotFound
+	}
+
+	return false
+}
+
+// RetryAfter returns the delay the server asked for before retrying, if err
+// carries one.
+func RetryAfter(err error) time.Duration {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.RetryAfter
+	}
+	return 0
+}
+
+// newStatusError builds a StatusError from a response.
+func newStatusError(rawURL string, code int, status string, header http.Header) *StatusError {
+	return &StatusError{
+		URL:        rawURL,
+		StatusCode: code,
+		Status:     status,
+		RetryAfter: parseRetryAfter(header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter parses a Retry-After value given in seconds or as an HTTP
+// date.
+func parseRetryAfter(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// classifyError wraps DNS and TLS failures connecting to rawURL in their
+// exported types; other errors are returned unchanged.
+func classifyError(rawURL string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return &DNSError{URL: rawURL, Err: dnsErr}
+	}
+
+	var (
+		verifyErr   *tls.CertificateVerificationError
+		headerErr   tls.RecordHeaderError
+		alertErr    tls.AlertError
+		unknownErr  x509.UnknownAuthorityError
+		hostnameErr x509.HostnameError
+		invalidErr  x509.CertificateInvalidError
+	)
+	if errors.As(err, &verifyErr) || errors.As(err, &headerErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &unknownErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return &TLSError{URL: rawURL, Err: err}
+	}
+
+	return err
+}
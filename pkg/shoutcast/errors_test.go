@@ -0,0 +1,44 @@
+package shoutcast
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestIsPermanent(t *testing.T) {
+	const u = "https://example.com/stream"
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"not found", &StatusError{URL: u, StatusCode: 404}, true},
+		{"too many requests", &StatusError{URL: u, StatusCode: 429}, false},
+		{"unavailable", &StatusError{URL: u, StatusCode: 503}, false},
+		{"not a stream", &NotStreamError{URL: u}, true},
+		{"empty playlist", &PlaylistEmptyError{URL: u, Format: "PLS"}, true},
+		{"unknown host", classifyError(u, &net.DNSError{Name: "example.com", IsNotFound: true}), true},
+		{"dns timeout", classifyError(u, &net.DNSError{Name: "example.com", IsTimeout: true}), false},
+		{"unknown authority", classifyError(u, x509.UnknownAuthorityError{}), true},
+		{"alert", classifyError(u, fmt.Errorf("remote error: %w", tls.AlertError(42))), true},
+		{"handshake timeout", classifyError(u, &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}), false},
+		{"handshake reset", classifyError(u, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}), false},
+		{"wrapped", fmt.Errorf("%s: %w", u, &StatusError{URL: u, StatusCode: 410}), true},
+		{"other", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanent(tt.err); got != tt.want {
+				t.Errorf("IsPermanent(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
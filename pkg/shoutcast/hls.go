@@ -0,0 +1,504 @@
+package shoutcast
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zachfi/streamgo/pkg/id3"
+)
+
+const (
+	// hlsLiveEdgeSegments is how many segments from the end of a live
+	// playlist playback starts at, as recommended by the HLS spec.
+	hlsLiveEdgeSegments = 3
+
+	defaultHLSTargetDuration = 10 * time.Second
+)
+
+// isHLSPlaylist reports whether content is an HLS master or media playlist
+// rather than a simple M3U list of stream URLs.
+func isHLSPlaylist(content string) bool {
+	return strings.Contains(content, "#EXT-X-TARGETDURATION") ||
+		strings.Contains(content, "#EXT-X-STREAM-INF") ||
+		strings.Contains(content, "#EXT-X-MEDIA-SEQUENCE")
+}
+
+// hlsVariant is an entry of a master playlist.
+type hlsVariant struct {
+	uri       string
+	bandwidth int
+}
+
+// hlsSegment is an entry of a media playlist.
+type hlsSegment struct {
+	uri      string
+	seq      int64
+	duration time.Duration
+	title    string
+}
+
+// hlsPlaylist is a parsed master or media playlist. A master playlist only
+// has variants.
+type hlsPlaylist struct {
+	variants       []hlsVariant
+	segments       []hlsSegment
+	targetDuration time.Duration
+	ended          bool
+}
+
+// parseHLSPlaylist parses the subset of an HLS playlist needed to record
+// audio. Encrypted and fragmented MP4 playlists are rejected.
+func parseHLSPlaylist(r io.Reader) (*hlsPlaylist, error) {
+	p := &hlsPlaylist{}
+
+	var (
+		seq      int64
+		duration time.Duration
+		title    string
+		inf      bool
+		variant  *hlsVariant
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attrs := parseHLSAttributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			bw, _ := strconv.Atoi(attrs["BANDWIDTH"])
+			variant = &hlsVariant{bandwidth: bw}
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			secs, err := strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid target duration %q", line)
+			}
+			p.targetDuration = time.Duration(secs) * time.Second
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			n, err := strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid media sequence %q", line)
+			}
+			seq = n
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			attrs := parseHLSAttributes(strings.TrimPrefix(line, "#EXT-X-KEY:"))
+			if attrs["METHOD"] != "" && attrs["METHOD"] != "NONE" {
+				return nil, fmt.Errorf("encrypted HLS segments are not supported (METHOD=%s)", attrs["METHOD"])
+			}
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			return nil, errors.New("fragmented MP4 HLS segments are not supported")
+		case strings.HasPrefix(line, "#EXTINF:"):
+			durStr, t, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			secs, _ := strconv.ParseFloat(strings.TrimSpace(durStr), 64)
+			duration = time.Duration(secs * float64(time.Second))
+			title = strings.TrimSpace(t)
+			inf = true
+		case line == "#EXT-X-ENDLIST":
+			p.ended = true
+		case strings.HasPrefix(line, "#"):
+			// Other tags and comments are not needed for recording.
+		case variant != nil:
+			variant.uri = line
+			p.variants = append(p.variants, *variant)
+			variant = nil
+		case inf:
+			p.segments = append(p.segments, hlsSegment{
+				uri:      line,
+				seq:      seq,
+				duration: duration,
+				title:    title,
+			})
+			seq++
+			inf = false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+
+	return p, nil
+}
+
+// parseHLSAttributes parses an attribute list such as
+// BANDWIDTH=128000,CODECS="mp4a.40.2,mp3".
+func parseHLSAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				val, rest = rest[1:], ""
+			} else {
+				val, rest = rest[1:end+1], rest[end+2:]
+			}
+			_, rest, _ = strings.Cut(rest, ",")
+		} else {
+			val, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[strings.TrimSpace(key)] = val
+		s = rest
+	}
+	return attrs
+}
+
+// selectVariant picks the highest bandwidth variant that doesn't exceed
+// maxBandwidth, or the lowest one if all of them do. A maxBandwidth of zero
+// selects the highest bandwidth.
+func selectVariant(variants []hlsVariant, maxBandwidth int) hlsVariant {
+	best := -1
+	lowest := 0
+	for i, v := range variants {
+		if v.bandwidth < variants[lowest].bandwidth {
+			lowest = i
+		}
+		if maxBandwidth > 0 && v.bandwidth > maxBandwidth {
+			continue
+		}
+		if best < 0 || v.bandwidth > variants[best].bandwidth {
+			best = i
+		}
+	}
+	if best < 0 {
+		best = lowest
+	}
+	return variants[best]
+}
+
+// hlsReader polls a media playlist and exposes its segments, in media
+// sequence order and without duplicates, as a continuous audio stream.
+type hlsReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	o      *options
+	client *http.Client
+	stream *Stream
+
+	mediaURL       *url.URL
+	targetDuration time.Duration
+	nextReload     time.Time
+	lastSeq        int64
+	started        bool
+	ended          bool
+
+	queue   []hlsSegment
+	cur     []byte
+	pending *Metadata // the title of cur, reported before cur is read
+}
+
+// openHLS opens an HLS master or media playlist as a Stream. Track changes
+// are taken from ID3 timed metadata in the segments or from #EXTINF titles.
+// The first segment is fetched before returning: the stream only reports
+// metadata if that segment has a title, as many live playlists have none.
+func openHLS(ctx context.Context, rawURL string, o *options) (*Stream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	r := &hlsReader{
+		ctx:     ctx,
+		cancel:  cancel,
+		o:       o,
+		client:  o.httpClient(),
+		lastSeq: -1,
+	}
+
+	p, header, err := r.fetchPlaylist(u)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	decoder, err := o.textDecoder(header)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	var bitrate int
+	if len(p.variants) > 0 {
+		v := selectVariant(p.variants, o.hlsMaxBandwidth)
+		u, err = u.Parse(v.uri)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("invalid variant URL %q: %w", v.uri, err)
+		}
+		o.logger.Info("selected HLS variant", "url", u.String(), "bandwidth", v.bandwidth)
+		bitrate = v.bandwidth / 1000
+
+		if p, _, err = r.fetchPlaylist(u); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	r.mediaURL = u
+	r.enqueue(p)
+
+	s := &Stream{
+		Name:        decoder.decode(header.Get("icy-name")),
+		Genre:       decoder.decode(header.Get("icy-genre")),
+		Description: decoder.decode(header.Get("icy-description")),
+		URL:         decoder.decode(header.Get("icy-url")),
+		Bitrate:     bitrate,
+		Public:      header.Get("icy-pub") == "1",
+		Server:      serverName(header),
+		AudioInfo:   audioInfoFromHeader(header),
+		Header:      header.Clone(),
+		decoder:     decoder,
+		rc:          r,
+		ctx:         ctx,
+		logger:      o.logger,
+	}
+	r.stream = s
+
+	if err := r.fill(); err != nil {
+		cancel()
+		if err == io.EOF {
+			return nil, &PlaylistEmptyError{URL: rawURL, Format: "HLS"}
+		}
+		return nil, err
+	}
+	s.timedMetadata = r.pending != nil
+
+	return s, nil
+}
+
+// fetchPlaylist downloads and parses the playlist at u.
+func (r *hlsReader) fetchPlaylist(u *url.URL) (*hlsPlaylist, http.Header, error) {
+	body, header, err := r.fetch(u, r.o.playlistTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := parseHLSPlaylist(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, header, nil
+}
+
+// fetch downloads u. The client sets no overall timeout, so each request,
+// body included, is bounded by timeout: a server that stops sending must
+// fail the read rather than hang it.
+func (r *hlsReader) fetch(u *url.URL, timeout time.Duration) ([]byte, http.Header, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	r.o.setHeaders(req)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, nil, classifyError(u.String(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, newStatusError(u.String(), resp.StatusCode, resp.Status, resp.Header)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", u, err)
+	}
+	return body, resp.Header, nil
+}
+
+// enqueue adds the segments of p that haven't been seen yet. On the first
+// load of a live playlist playback starts near the live edge.
+func (r *hlsReader) enqueue(p *hlsPlaylist) int {
+	r.targetDuration = p.targetDuration
+	if r.targetDuration <= 0 {
+		r.targetDuration = defaultHLSTargetDuration
+	}
+	r.ended = p.ended
+
+	segments := p.segments
+	if !r.started {
+		r.started = true
+		if !p.ended && len(segments) > hlsLiveEdgeSegments {
+			segments = segments[len(segments)-hlsLiveEdgeSegments:]
+		}
+	} else if n := len(segments); n > 0 && segments[n-1].seq < r.lastSeq {
+		// The media sequence went backwards, so the encoder restarted.
+		r.o.logger.Warn("HLS media sequence reset", "last", r.lastSeq, "now", segments[n-1].seq)
+		r.lastSeq = segments[0].seq - 1
+	}
+
+	added := 0
+	for _, seg := range segments {
+		if seg.seq <= r.lastSeq {
+			continue
+		}
+		r.queue = append(r.queue, seg)
+		r.lastSeq = seg.seq
+		added++
+	}
+	return added
+}
+
+// reload waits until the playlist is due to be reloaded and then polls it.
+// The playlist is reloaded after a target duration when it changed, and
+// after half of one when it didn't.
+func (r *hlsReader) reload() error {
+	if d := time.Until(r.nextReload); d > 0 {
+		t := time.NewTimer(d)
+		select {
+		case <-r.ctx.Done():
+			t.Stop()
+			return r.ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	p, _, err := r.fetchPlaylist(r.mediaURL)
+	if err != nil {
+		return err
+	}
+
+	next := r.targetDuration
+	if r.enqueue(p) == 0 {
+		next /= 2
+	}
+	r.nextReload = time.Now().Add(next)
+	return nil
+}
+
+// nextSegment downloads the next queued segment and extracts its audio and
+// title.
+func (r *hlsReader) nextSegment() error {
+	seg := r.queue[0]
+	r.queue = r.queue[1:]
+
+	u, err := r.mediaURL.Parse(seg.uri)
+	if err != nil {
+		return fmt.Errorf("invalid segment URL %q: %w", seg.uri, err)
+	}
+
+	// A live segment has a target duration to arrive before playback
+	// falls behind.
+	data, _, err := r.fetch(u, max(r.o.playlistTimeout, r.targetDuration))
+	if err != nil {
+		return fmt.Errorf("segment %d: %w", seg.seq, err)
+	}
+
+	audio, tags, err := extractSegmentAudio(data)
+	if err != nil {
+		return fmt.Errorf("segment %d: %w", seg.seq, err)
+	}
+
+	// EXTINF titles are raw playlist text, like ICY metadata; ID3 text is
+	// decoded to UTF-8 already and must not be decoded again.
+	title := r.stream.decoder.decode(seg.title)
+	for _, tag := range tags {
+		if t := id3StreamTitle(tag); t != "" {
+			title = t
+		}
+	}
+	if title != "" {
+		r.pending = &Metadata{
+			StreamTitle: title,
+			Fields:      map[string]string{"StreamTitle": title},
+		}
+	}
+
+	r.cur = audio
+	return nil
+}
+
+// fill fetches segments, reloading the playlist as needed, until there is
+// audio to read.
+func (r *hlsReader) fill() error {
+	for len(r.cur) == 0 {
+		if err := r.ctx.Err(); err != nil {
+			return err
+		}
+		if len(r.queue) == 0 {
+			if r.ended {
+				return io.EOF
+			}
+			if err := r.reload(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := r.nextSegment(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *hlsReader) Read(p []byte) (int, error) {
+	if err := r.fill(); err != nil {
+		return 0, err
+	}
+	if r.pending != nil {
+		r.stream.updateMetadata(r.pending)
+		r.pending = nil
+	}
+
+	n := copy(p, r.cur)
+	r.cur = r.cur[n:]
+	return n, nil
+}
+
+func (r *hlsReader) Close() error {
+	r.cancel()
+	r.o.closeIdleConnections()
+	return nil
+}
+
+// extractSegmentAudio returns the audio elementary stream of a segment and
+// any ID3 tags it carries. MPEG-TS segments are demultiplexed; packed audio
+// segments have their leading ID3 tags removed.
+func extractSegmentAudio(data []byte) ([]byte, []*id3.Tag, error) {
+	if isMPEGTS(data) {
+		return demuxTS(data)
+	}
+
+	var tags []*id3.Tag
+	for {
+		tag, n, ok := id3.Parse(data)
+		if !ok {
+			break
+		}
+		tags = append(tags, tag)
+		data = data[n:]
+	}
+	return data, tags, nil
+}
+
+// id3StreamTitle returns "Artist - Title" from the TPE1 and TIT2 frames of
+// t, or whichever of the two is present.
+func id3StreamTitle(t *id3.Tag) string {
+	artist := strings.Join(t.Text("TPE1"), "/")
+	title := strings.Join(t.Text("TIT2"), " ")
+	switch {
+	case artist != "" && title != "":
+		return artist + " - " + title
+	case title != "":
+		return title
+	default:
+		return artist
+	}
+}
@@ -0,0 +1,219 @@
+package shoutcast
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zachfi/streamgo/pkg/id3"
+)
+
+// serveHLS serves an ended media playlist at /live.m3u8 with one segment per
+// entry of segments, titled by the matching entry of titles. The playlist
+// announces charset as its icy-metadata-charset, if set.
+func serveHLS(t *testing.T, charset string, titles []string, segments [][]byte) string {
+	t.Helper()
+
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:0\n")
+	for i, title := range titles {
+		playlist.WriteString("#EXTINF:1.0," + title + "\n")
+		playlist.WriteString("seg" + string(rune('0'+i)) + ".mp3\n")
+	}
+	playlist.WriteString("#EXT-X-ENDLIST\n")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/live.m3u8", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		if charset != "" {
+			w.Header().Set("icy-metadata-charset", charset)
+		}
+		io.WriteString(w, playlist.String())
+	})
+	for i, seg := range segments {
+		mux.HandleFunc("/seg"+string(rune('0'+i))+".mp3", func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "audio/mpeg")
+			w.Write(seg)
+		})
+	}
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv.URL + "/live.m3u8"
+}
+
+func TestOpenHLSMetadata(t *testing.T) {
+	audio := bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x00}, 256)
+
+	tag := id3.New()
+	tag.SetText("TPE1", "Artist")
+	tag.SetText("TIT2", "Title")
+	tagged := append(tag.Encode(0), audio...)
+
+	accented := id3.New()
+	accented.SetText("TPE1", "Artist")
+	accented.SetText("TIT2", "Café")
+	taggedAccented := append(accented.Encode(0), audio...)
+
+	tests := []struct {
+		name     string
+		charset  string // announced by the server, and forced
+		titles   []string
+		segments [][]byte
+		want     []string // titles reported, in order; none means no metadata
+	}{
+		{
+			name:     "untitled",
+			titles:   []string{"", ""},
+			segments: [][]byte{audio, audio},
+		},
+		{
+			name:     "extinf titles",
+			titles:   []string{"First", "Second"},
+			segments: [][]byte{audio, audio},
+			want:     []string{"First", "Second"},
+		},
+		{
+			name:     "id3 titles",
+			titles:   []string{"", ""},
+			segments: [][]byte{tagged, audio},
+			want:     []string{"Artist - Title"},
+		},
+		{
+			name:     "extinf titles in the server charset",
+			charset:  "windows-1252",
+			titles:   []string{"Caf\xe9", ""},
+			segments: [][]byte{audio, audio},
+			want:     []string{"Café"},
+		},
+		{
+			name:     "id3 titles with a server charset",
+			charset:  "windows-1252",
+			titles:   []string{"", ""},
+			segments: [][]byte{taggedAccented, audio},
+			want:     []string{"Artist - Café"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := serveHLS(t, tt.charset, tt.titles, tt.segments)
+			s, err := OpenContext(context.Background(), url, WithServerCharset(true))
+			if err != nil {
+				t.Fatalf("OpenContext: %v", err)
+			}
+			defer s.Close()
+
+			if got, want := s.HasMetadata(), len(tt.want) > 0; got != want {
+				t.Fatalf("HasMetadata() = %v, want %v", got, want)
+			}
+
+			var titles []string
+			var offsets []int64
+			s.MetadataEventFunc = func(e MetadataEvent) {
+				titles = append(titles, e.Metadata.StreamTitle)
+				offsets = append(offsets, e.Offset)
+			}
+
+			b, err := io.ReadAll(s)
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if want := 2 * len(audio); len(b) != want {
+				t.Errorf("read %d bytes of audio, want %d", len(b), want)
+			}
+
+			if len(tt.want) == 0 {
+				return
+			}
+			if strings.Join(titles, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("titles = %q, want %q", titles, tt.want)
+			}
+			for i, off := range offsets {
+				if want := int64(i * len(audio)); off != want {
+					t.Errorf("title %d at offset %d, want %d", i, off, want)
+				}
+			}
+		})
+	}
+}
+
+// TestOpenHLSStalled checks that a server that stops sending a segment or
+// a playlist reload fails the read instead of hanging it.
+func TestOpenHLSStalled(t *testing.T) {
+	audio := bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x00}, 256)
+
+	// stall sends the headers and some of the body, then nothing more.
+	stall := func(w http.ResponseWriter, r *http.Request) {
+		w.Write(audio[:16])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}
+
+	tests := []struct {
+		name     string
+		playlist string
+		segment  http.HandlerFunc
+		reload   http.HandlerFunc
+	}{
+		{
+			name:     "segment",
+			playlist: "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXTINF:1.0,\nseg0.mp3\n#EXTINF:1.0,\nseg1.mp3\n#EXT-X-ENDLIST\n",
+			segment:  stall,
+		},
+		{
+			name:     "playlist reload",
+			playlist: "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXTINF:1.0,\nseg0.mp3\n",
+			reload:   stall,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The playlist is reloaded once the segment was played.
+			var played atomic.Bool
+			mux := http.NewServeMux()
+			mux.HandleFunc("/live.m3u8", func(w http.ResponseWriter, r *http.Request) {
+				if played.Load() && tt.reload != nil {
+					tt.reload(w, r)
+					return
+				}
+				io.WriteString(w, tt.playlist)
+			})
+			mux.HandleFunc("/seg0.mp3", func(w http.ResponseWriter, _ *http.Request) {
+				played.Store(true)
+				w.Write(audio)
+			})
+			if tt.segment != nil {
+				mux.HandleFunc("/seg1.mp3", tt.segment)
+			}
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			s, err := OpenContext(context.Background(), srv.URL+"/live.m3u8", WithPlaylistTimeout(100*time.Millisecond))
+			if err != nil {
+				t.Fatalf("OpenContext: %v", err)
+			}
+			defer s.Close()
+
+			start := time.Now()
+			b, err := io.ReadAll(s)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("ReadAll: %v, want context.DeadlineExceeded", err)
+			}
+			if !bytes.Equal(b, audio) {
+				t.Errorf("read %d bytes of audio, want the %d of the first segment", len(b), len(audio))
+			}
+			if d := time.Since(start); d > 5*time.Second {
+				t.Errorf("took %v to fail", d)
+			}
+		})
+	}
+}
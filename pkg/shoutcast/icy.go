@@ -0,0 +1,170 @@
+package shoutcast
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// isICYResponse reports whether err is net/http rejecting a response for
+// its "ICY 200 OK" style status line, as sent by SHOUTcast v1 servers.
+// net/http only describes this in the error text, which names the protocol
+// it failed to parse, so the match is on that; TestICYFallback fails if
+// net/http words it differently.
+func isICYResponse(err error) bool {
+	return err != nil && strings.Contains(err.Error(), `malformed HTTP version "ICY"`)
+}
+
+// openICY connects to rawURL over a plain net.Conn and speaks the legacy ICY
+// protocol. It returns the icy-* headers and the body positioned at the
+// first audio byte. Custom clients and transports don't apply here; the dial
+// and header timeouts do.
+func openICY(ctx context.Context, rawURL string, o *options) (http.Header, io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "https" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: o.dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, nil, classifyError(rawURL, err)
+	}
+	if u.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			// Only certificate and protocol errors are TLS errors; a
+			// timeout or reset during the handshake is worth retrying.
+			conn.Close()
+			return nil, nil, classifyError(rawURL, err)
+		}
+		conn = tlsConn
+	}
+
+	// Closing the connection is the only way to abort a blocked read, so tie
+	// it to ctx for the lifetime of the stream.
+	body := &icyBody{conn: conn}
+	body.stop = context.AfterFunc(ctx, func() { conn.Close() })
+
+	if o.headerTimeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(o.headerTimeout))
+	}
+
+	if err := writeICYRequest(conn, u, o); err != nil {
+		body.Close()
+		return nil, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+	header, err := readICYResponse(br)
+	if err != nil {
+		body.Close()
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		var se *StatusError
+		if errors.As(err, &se) {
+			se.URL = rawURL
+		}
+		return nil, nil, err
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	body.r = br
+
+	return header, body, nil
+}
+
+// writeICYRequest sends a minimal HTTP/1.0 request; v1 servers don't
+// understand keep-alive or chunked encoding.
+func writeICYRequest(w io.Writer, u *url.URL, o *options) error {
+	req := make(http.Header)
+	req.Set("Host", u.Host)
+	req.Set("Accept", "*/*")
+	req.Set("User-Agent", o.userAgent)
+	for k, v := range o.header {
+		req[k] = v
+	}
+	req.Set("Icy-MetaData", "1")
+	req.Set("Connection", "close")
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "GET %s HTTP/1.0\r\n", u.RequestURI())
+	if err := req.Write(bw); err != nil {
+		return err
+	}
+	bw.WriteString("\r\n")
+	return bw.Flush()
+}
+
+// readICYResponse parses the status line and headers. Both "ICY 200 OK" and
+// "HTTP/1.x 200 OK" status lines are accepted.
+func readICYResponse(br *bufio.Reader) (http.Header, error) {
+	tp := textproto.NewReader(br)
+
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status line: %w", err)
+	}
+
+	proto, status, ok := strings.Cut(line, " ")
+	if !ok || (proto != "ICY" && !strings.HasPrefix(proto, "HTTP/")) {
+		return nil, fmt.Errorf("malformed ICY status line %q", line)
+	}
+	status = strings.TrimSpace(status)
+	code, _, _ := strings.Cut(status, " ")
+
+	mh, err := tp.ReadMIMEHeader()
+	if code != "200" {
+		// The headers may carry Retry-After; read them on a best-effort
+		// basis.
+		n, _ := strconv.Atoi(code)
+		return nil, newStatusError("", n, status, http.Header(mh))
+	}
+	if err != nil && !(errors.Is(err, io.EOF) && len(mh) > 0) {
+		return nil, fmt.Errorf("failed to read headers: %w", err)
+	}
+
+	return http.Header(mh), nil
+}
+
+// icyBody is the audio body of a raw ICY connection.
+type icyBody struct {
+	conn net.Conn
+	r    io.Reader
+	stop func() bool
+	once sync.Once
+}
+
+func (b *icyBody) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+func (b *icyBody) Close() error {
+	var err error
+	b.once.Do(func() {
+		b.stop()
+		err = b.conn.Close()
+	})
+	return err
+}
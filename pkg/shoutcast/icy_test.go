@@ -0,0 +1,201 @@
+package shoutcast
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveICY answers every connection with response, as a SHOUTcast v1
+// server would, and returns the URL to connect to and the requests
+// received.
+func serveICY(t *testing.T, response []byte) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	requests := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var req strings.Builder
+				br := bufio.NewReader(conn)
+				for {
+					line, err := br.ReadString('\n')
+					req.WriteString(line)
+					if err != nil || line == "\r\n" {
+						break
+					}
+				}
+				requests <- req.String()
+				conn.Write(response)
+			}()
+		}
+	}()
+
+	return "http://" + ln.Addr().String() + "/stream", requests
+}
+
+// TestICYFallback checks that a server answering "ICY 200 OK" is read over
+// a raw connection. It also pins down the net/http error isICYResponse
+// relies on.
+func TestICYFallback(t *testing.T) {
+	audio := bytes.Repeat([]byte{0xAA}, 64)
+	response := append([]byte("ICY 200 OK\r\n"+
+		"icy-notice2:SHOUTcast Distributed Network Audio Server/Linux v1.9.8<BR>\r\n"+
+		"icy-name:Test Radio\r\n"+
+		"icy-br:128\r\n"+
+		"icy-metaint:16\r\n"+
+		"content-type:audio/mpeg\r\n\r\n"),
+		icyStream(audio, 16, []string{"Artist - Title"})...)
+	rawURL, requests := serveICY(t, response)
+
+	_, err := http.Get(rawURL)
+	if !isICYResponse(err) {
+		t.Fatalf("net/http error %v isn't recognised as an ICY response", err)
+	}
+	<-requests
+
+	s, err := OpenContext(context.Background(), rawURL, WithHeader("X-Test", "1"), WithUserAgent("test/1.0"))
+	if err != nil {
+		t.Fatalf("OpenContext: %v", err)
+	}
+	defer s.Close()
+
+	if s.Name != "Test Radio" || s.Bitrate != 128 || s.ContentType != "audio/mpeg" || !s.HasMetadata() {
+		t.Errorf("stream = %q, %d kbps, %q, metadata %v, want the ICY headers", s.Name, s.Bitrate, s.ContentType, s.HasMetadata())
+	}
+	if want := "SHOUTcast Distributed Network Audio Server/Linux v1.9.8"; s.Server != want {
+		t.Errorf("Server = %q, want %q", s.Server, want)
+	}
+	var title string
+	s.MetadataCallbackFunc = func(m *Metadata) { title = m.StreamTitle }
+	got, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, audio) || title != "Artist - Title" {
+		t.Errorf("read %d bytes titled %q, want %d titled %q", len(got), title, len(audio), "Artist - Title")
+	}
+
+	// The probe and the HTTP attempt come first; the ICY request is last.
+	var req string
+	for len(requests) > 0 {
+		req = <-requests
+	}
+	for _, want := range []string{"GET /stream HTTP/1.0\r\n", "Icy-Metadata: 1\r\n", "User-Agent: test/1.0\r\n", "X-Test: 1\r\n", "Connection: close\r\n"} {
+		if !strings.Contains(req, want) {
+			t.Errorf("ICY request %q lacks %q", req, want)
+		}
+	}
+}
+
+func TestICYStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   string
+		code       int
+		retryAfter time.Duration
+		permanent  bool
+	}{
+		{"not found", "ICY 404 Resource Not Found\r\n\r\n", 404, 0, true},
+		{"full", "ICY 503 Service Unavailable\r\nRetry-After: 30\r\n\r\n", 503, 30 * time.Second, false},
+		{"no headers", "ICY 401 Service Unavailable\r\n", 401, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rawURL, _ := serveICY(t, []byte(tt.response))
+			_, err := OpenContext(context.Background(), rawURL)
+
+			var se *StatusError
+			if !errors.As(err, &se) {
+				t.Fatalf("err = %v, want a StatusError", err)
+			}
+			if se.StatusCode != tt.code || se.URL != rawURL {
+				t.Errorf("StatusError = %d from %q, want %d from %q", se.StatusCode, se.URL, tt.code, rawURL)
+			}
+			if got := RetryAfter(err); got != tt.retryAfter {
+				t.Errorf("RetryAfter() = %v, want %v", got, tt.retryAfter)
+			}
+			if got := IsPermanent(err); got != tt.permanent {
+				t.Errorf("IsPermanent() = %v, want %v", got, tt.permanent)
+			}
+		})
+	}
+}
+
+func TestReadICYResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantName string
+		wantErr  bool
+	}{
+		{"icy", "ICY 200 OK\r\nicy-name: Radio\r\n\r\naudio", "Radio", false},
+		{"http", "HTTP/1.0 200 OK\r\nicy-name: Radio\r\n\r\naudio", "Radio", false},
+		{"headers cut short", "ICY 200 OK\r\nicy-name: Radio\r\n", "Radio", false},
+		{"not icy", "SOURCE 200 OK\r\n\r\n", "", true},
+		{"no status", "", "", true},
+		{"no headers", "ICY 200 OK\r\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := bufio.NewReader(strings.NewReader(tt.response))
+			header, err := readICYResponse(br)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readICYResponse() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := header.Get("icy-name"); got != tt.wantName {
+				t.Errorf("icy-name = %q, want %q", got, tt.wantName)
+			}
+			if rest, _ := io.ReadAll(br); strings.HasSuffix(tt.response, "audio") && string(rest) != "audio" {
+				t.Errorf("body = %q, want %q", rest, "audio")
+			}
+		})
+	}
+}
+
+func TestWriteICYRequest(t *testing.T) {
+	u, _ := url.Parse("http://radio.example.com:8000/live?id=1")
+	o := newOptions(WithUserAgent("test/1.0"), WithHeader("Icy-MetaData", "0"))
+
+	var b bytes.Buffer
+	if err := writeICYRequest(&b, u, o); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(&b))
+	if err != nil {
+		t.Fatalf("request isn't valid HTTP: %v", err)
+	}
+	if req.Proto != "HTTP/1.0" || req.RequestURI != "/live?id=1" || req.Host != "radio.example.com:8000" {
+		t.Errorf("request line = %s %s, Host %s", req.Proto, req.RequestURI, req.Host)
+	}
+	// Icy-MetaData can't be turned off, or the stream couldn't be parsed.
+	for k, want := range map[string]string{"User-Agent": "test/1.0", "Icy-Metadata": "1", "Connection": "close", "Accept": "*/*"} {
+		if got := req.Header.Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+}
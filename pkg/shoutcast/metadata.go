@@ -1,36 +1,117 @@
 package shoutcast
 
 import (
-	"log"
 	"strings"
 )
 
 // Metadata represents the stream metadata sent by the server
 type Metadata struct {
 	StreamTitle string
+	StreamURL   string
+
+	// Fields holds every key/value pair of the metadata block, including
+	// StreamTitle, StreamUrl and vendor keys such as adw_ad or
+	// durationMilliseconds.
+	Fields map[string]string
 }
 
-// NewMetadata returns parsed metadata
+// NewMetadata returns parsed metadata. Values that aren't valid UTF-8 are
+// decoded as DefaultCharset.
+//
+// A block is a sequence of key='value'; pairs padded with NUL bytes. Values
+// may themselves contain quotes, semicolons and equals signs, as in
+// StreamTitle='Guns N' Roses - Paradise City; Live'; so a quote only ends a
+// value when it is followed by ';' and then either the end of the block or
+// the next key.
 func NewMetadata(b []byte) *Metadata {
-	m := &Metadata{}
+	return parseMetadata(b, defaultTextDecoder)
+}
 
-	props := strings.Split(string(b), ";")
-	log.Print("[DEBUG] Received metadata: ", props)
+// parseMetadata parses a metadata block, decoding its values to UTF-8
+// with d.
+func parseMetadata(b []byte, d *textDecoder) *Metadata {
+	s := strings.TrimRight(string(b), "\x00")
 
-	for _, prop := range props {
-		if prop == "" {
-			continue
+	m := &Metadata{Fields: make(map[string]string)}
+
+	for s != "" {
+		s = strings.TrimLeft(s, "; \t\r\n")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
 		}
-		parts := strings.Split(prop, "=")
-		if len(parts) >= 2 && parts[0] == "StreamTitle" {
-			m.StreamTitle = strings.Trim(parts[1], "'")
+		key := strings.TrimSpace(s[:eq])
+		rest := s[eq+1:]
+
+		var value string
+		if len(rest) > 0 && (rest[0] == '\'' || rest[0] == '"') {
+			value, s = splitQuotedValue(rest[1:], rest[0])
+		} else {
+			value, s, _ = strings.Cut(rest, ";")
+			value = strings.TrimSpace(value)
+		}
+
+		if key != "" {
+			m.Fields[key] = d.decode(value)
 		}
 	}
 
+	m.StreamTitle = m.Fields["StreamTitle"]
+	m.StreamURL = m.Fields["StreamUrl"]
+
 	return m
 }
 
-// Equals compares two Metadata structures for equality
+// splitQuotedValue returns the value up to its closing quote and the rest
+// of the block following it.
+func splitQuotedValue(s string, quote byte) (value, rest string) {
+	for i := 0; i < len(s); i++ {
+		if s[i] != quote {
+			continue
+		}
+		after := s[i+1:]
+		if after == "" {
+			return s[:i], ""
+		}
+		if after[0] != ';' {
+			continue
+		}
+		if next := strings.TrimLeft(after[1:], " \t\r\n"); next == "" || startsWithKey(next) {
+			return s[:i], after[1:]
+		}
+	}
+
+	// No terminating quote; take everything up to the last quote, if any.
+	if i := strings.LastIndexByte(s, quote); i >= 0 {
+		return s[:i], ""
+	}
+	return strings.TrimSuffix(s, ";"), ""
+}
+
+// startsWithKey reports whether s begins with a metadata key followed by '='.
+func startsWithKey(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '=':
+			return i > 0
+		case c == '_' || c == '-' || c == '.',
+			'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// Get returns the value of key, or "" if the block didn't contain it.
+func (m *Metadata) Get(key string) string {
+	return m.Fields[key]
+}
+
+// Equals compares two Metadata structures for equality. Only StreamTitle and
+// StreamURL are compared; vendor keys such as durationMilliseconds can change
+// without the track changing.
 func (m *Metadata) Equals(other *Metadata) bool {
 	if other == nil {
 		return false
@@ -38,5 +119,8 @@ func (m *Metadata) Equals(other *Metadata) bool {
 	if m.StreamTitle != other.StreamTitle {
 		return false
 	}
+	if m.StreamURL != other.StreamURL {
+		return false
+	}
 	return true
 }
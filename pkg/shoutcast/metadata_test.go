@@ -0,0 +1,80 @@
+package shoutcast
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestNewMetadata(t *testing.T) {
+	tests := []struct {
+		name  string
+		block string
+		want  map[string]string
+	}{
+		{
+			name:  "title and url",
+			block: "StreamTitle='Artist - Title';StreamUrl='http://example.com/';",
+			want:  map[string]string{"StreamTitle": "Artist - Title", "StreamUrl": "http://example.com/"},
+		},
+		{
+			name:  "quote and semicolon in value",
+			block: "StreamTitle='Guns N' Roses - Paradise City; Live';StreamUrl='';",
+			want:  map[string]string{"StreamTitle": "Guns N' Roses - Paradise City; Live", "StreamUrl": ""},
+		},
+		{
+			name:  "quote and semicolon at the end of the block",
+			block: "StreamTitle='Guns N' Roses - Paradise City; Live';",
+			want:  map[string]string{"StreamTitle": "Guns N' Roses - Paradise City; Live"},
+		},
+		{
+			name:  "nul padding",
+			block: "StreamTitle='Artist - Title';\x00\x00\x00\x00\x00\x00",
+			want:  map[string]string{"StreamTitle": "Artist - Title"},
+		},
+		{
+			name:  "vendor keys",
+			block: "StreamTitle='Ad';adw_ad='true';durationMilliseconds='30000';",
+			want:  map[string]string{"StreamTitle": "Ad", "adw_ad": "true", "durationMilliseconds": "30000"},
+		},
+		{
+			name:  "equals sign in value",
+			block: "StreamTitle='a=b';StreamUrl='http://example.com/?id=1';",
+			want:  map[string]string{"StreamTitle": "a=b", "StreamUrl": "http://example.com/?id=1"},
+		},
+		{
+			name:  "double quotes",
+			block: `StreamTitle="Artist - Title";`,
+			want:  map[string]string{"StreamTitle": "Artist - Title"},
+		},
+		{
+			name:  "unquoted value",
+			block: "StreamTitle=Artist - Title;StreamUrl=;",
+			want:  map[string]string{"StreamTitle": "Artist - Title", "StreamUrl": ""},
+		},
+		{
+			name:  "missing closing quote",
+			block: "StreamTitle='Artist - Title",
+			want:  map[string]string{"StreamTitle": "Artist - Title"},
+		},
+		{
+			name:  "empty block",
+			block: "\x00\x00\x00\x00",
+			want:  map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMetadata([]byte(tt.block))
+			if !maps.Equal(m.Fields, tt.want) {
+				t.Errorf("Fields = %q, want %q", m.Fields, tt.want)
+			}
+			if m.StreamTitle != tt.want["StreamTitle"] {
+				t.Errorf("StreamTitle = %q, want %q", m.StreamTitle, tt.want["StreamTitle"])
+			}
+			if m.StreamURL != tt.want["StreamUrl"] {
+				t.Errorf("StreamURL = %q, want %q", m.StreamURL, tt.want["StreamUrl"])
+			}
+		})
+	}
+}
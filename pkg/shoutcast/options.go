@@ -0,0 +1,195 @@
+package shoutcast
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultUserAgent       = "iTunes/12.9.2 (Macintosh; OS X 10.14.3) AppleWebKit/606.4.5"
+	defaultDialTimeout     = 5 * time.Second
+	defaultHeaderTimeout   = 10 * time.Second
+	defaultPlaylistTimeout = 10 * time.Second
+)
+
+// Option configures how a stream is opened.
+type Option func(*options)
+
+type options struct {
+	client          *http.Client
+	transport       http.RoundTripper
+	header          http.Header
+	userAgent       string
+	dialTimeout     time.Duration
+	headerTimeout   time.Duration
+	playlistTimeout time.Duration
+	hlsMaxBandwidth int
+	charset         string
+	serverCharset   bool
+	logger          *slog.Logger
+
+	// defaultClient is built on first use, so that every request made for
+	// one OpenContext shares its connections.
+	defaultClient *http.Client
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		header:          make(http.Header),
+		userAgent:       defaultUserAgent,
+		dialTimeout:     defaultDialTimeout,
+		headerTimeout:   defaultHeaderTimeout,
+		playlistTimeout: defaultPlaylistTimeout,
+		charset:         DefaultCharset,
+		logger:          slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithHTTPClient uses c for playlist and stream requests. The client should
+// not set a Timeout, as that would cut long recordings short; the dial and
+// header timeout options do not apply to a custom client.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		o.client = c
+	}
+}
+
+// WithTransport uses rt for playlist and stream requests. The dial and header
+// timeout options do not apply to a custom transport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = rt
+	}
+}
+
+// WithHeader adds a header to every request, replacing any default value.
+func WithHeader(key, value string) Option {
+	return func(o *options) {
+		o.header.Set(key, value)
+	}
+}
+
+// WithUserAgent sets the User-Agent sent to the server.
+func WithUserAgent(ua string) Option {
+	return func(o *options) {
+		o.userAgent = ua
+	}
+}
+
+// WithDialTimeout sets the timeout for establishing the TCP connection.
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = d
+	}
+}
+
+// WithHeaderTimeout sets how long to wait for the response headers once
+// the request has been sent.
+func WithHeaderTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.headerTimeout = d
+	}
+}
+
+// WithPlaylistTimeout bounds the whole playlist request, including reading
+// the playlist body. It also bounds each HLS playlist reload and segment
+// download; a segment may take up to its target duration if that is longer.
+func WithPlaylistTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.playlistTimeout = d
+	}
+}
+
+// WithHLSMaxBandwidth selects the highest HLS variant whose bandwidth, in
+// bits per second, doesn't exceed bps. By default the highest bandwidth
+// variant is used.
+func WithHLSMaxBandwidth(bps int) Option {
+	return func(o *options) {
+		o.hlsMaxBandwidth = bps
+	}
+}
+
+// WithMetadataCharset sets the charset used to decode metadata and icy-*
+// header values that aren't valid UTF-8. See SupportedCharset.
+func WithMetadataCharset(name string) Option {
+	return func(o *options) {
+		o.charset = name
+	}
+}
+
+// WithServerCharset decodes all metadata in the charset the server announces
+// in the icy-metadata-charset header, when it sends one, even if the text
+// happens to be valid UTF-8.
+func WithServerCharset(enabled bool) Option {
+	return func(o *options) {
+		o.serverCharset = enabled
+	}
+}
+
+// WithLogger sets the logger used for connection and header diagnostics.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// httpClient returns the client used for playlist and stream requests.
+// Timeouts only cover establishing the connection; we don't want the stream
+// to time out while we're reading it.
+func (o *options) httpClient() *http.Client {
+	if o.client != nil {
+		return o.client
+	}
+	if o.defaultClient != nil {
+		return o.defaultClient
+	}
+
+	rt := o.transport
+	if rt == nil {
+		dialer := &net.Dialer{Timeout: o.dialTimeout}
+		rt = &http.Transport{
+			DialContext:           dialer.DialContext,
+			ResponseHeaderTimeout: o.headerTimeout,
+		}
+	}
+
+	o.defaultClient = &http.Client{Transport: rt}
+	return o.defaultClient
+}
+
+// closeIdleConnections closes the kept-alive connections of the default
+// transport, such as those left by playlist requests. A custom client or
+// transport may be shared with other code and is left alone.
+func (o *options) closeIdleConnections() {
+	if o.client == nil && o.transport == nil && o.defaultClient != nil {
+		o.defaultClient.CloseIdleConnections()
+	}
+}
+
+// setHeaders applies the default and configured headers to req.
+func (o *options) setHeaders(req *http.Request) {
+	req.Header.Set("accept", "*/*")
+	req.Header.Set("user-agent", o.userAgent)
+	for k, v := range o.header {
+		req.Header[k] = v
+	}
+}
+
+// textDecoder returns the decoder for metadata and header text of a stream
+// that answered with header.
+func (o *options) textDecoder(header http.Header) (*textDecoder, error) {
+	d, err := newTextDecoder(o.charset)
+	if err != nil {
+		return nil, err
+	}
+	if o.serverCharset {
+		d = d.withServerCharset(header.Get("icy-metadata-charset"))
+	}
+	return d, nil
+}
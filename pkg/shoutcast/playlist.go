@@ -1,127 +1,462 @@
 package shoutcast
 
 import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
-// parsePLS parses a PLS playlist file and returns the first stream URL
-func parsePLS(body io.Reader) (string, error) {
-	data, err := io.ReadAll(body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read playlist: %w", err)
-	}
+// maxPlaylistDepth limits how many playlists may point to further playlists
+// before resolution gives up.
+const maxPlaylistDepth = 5
 
-	content := string(data)
-	lines := strings.Split(content, "\n")
+// maxPlaylistSize is the most of a response body read to find out whether
+// it is a playlist. Station playlists are a few hundred bytes; a longer body
+// is most likely a stream sent without an audio content type, and a server
+// that bursts on connect fills this at once.
+const maxPlaylistSize = 64 * 1024
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "File") && strings.Contains(line, "=") {
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) == 2 {
-				url := strings.TrimSpace(parts[1])
-				if url != "" {
-					return url, nil
-				}
+// PlaylistEntry is a candidate stream listed in a playlist.
+type PlaylistEntry struct {
+	// URL of the stream, resolved against the playlist's URL.
+	URL string
+
+	// Title and Length as given by the playlist, if any. Length is zero
+	// for live streams.
+	Title  string
+	Length time.Duration
+}
+
+// playlistKind says what a URL turned out to point at.
+type playlistKind int
+
+const (
+	kindStream playlistKind = iota
+	kindHLS
+	kindPlaylist
+)
+
+// probeResult is the outcome of fetching a URL to see what it is.
+type probeResult struct {
+	kind    playlistKind
+	entries []PlaylistEntry // set for kindPlaylist
+}
+
+// parsePLS parses a PLS playlist. Entries are returned in FileN order with
+// their TitleN and LengthN values.
+func parsePLS(body io.Reader) ([]PlaylistEntry, error) {
+	byIndex := make(map[int]*PlaylistEntry)
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		var field string
+		for _, f := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, f) {
+				field = f
+				break
+			}
+		}
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(key[len(field):])
+		if err != nil {
+			continue
+		}
+
+		e := byIndex[n]
+		if e == nil {
+			e = &PlaylistEntry{}
+			byIndex[n] = e
+		}
+		switch field {
+		case "file":
+			e.URL = value
+		case "title":
+			e.Title = value
+		case "length":
+			// -1 marks a live stream.
+			if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+				e.Length = time.Duration(secs) * time.Second
 			}
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
 
-	return "", fmt.Errorf("no stream URL found in PLS playlist")
-}
+	indexes := make([]int, 0, len(byIndex))
+	for n := range byIndex {
+		indexes = append(indexes, n)
+	}
+	sort.Ints(indexes)
 
-// parseM3U parses an M3U playlist file and returns the first stream URL
-func parseM3U(body io.Reader) (string, error) {
-	data, err := io.ReadAll(body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read playlist: %w", err)
+	var entries []PlaylistEntry
+	for _, n := range indexes {
+		if e := byIndex[n]; e.URL != "" {
+			entries = append(entries, *e)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, &PlaylistEmptyError{Format: "PLS"}
 	}
 
-	content := string(data)
-	lines := strings.Split(content, "\n")
+	return entries, nil
+}
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
+// parseM3U parses a plain or extended M3U playlist. #EXTINF lines give the
+// length and title of the entry that follows.
+func parseM3U(body io.Reader) ([]PlaylistEntry, error) {
+	var entries []PlaylistEntry
+	var next PlaylistEntry
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if rest, ok := strings.CutPrefix(line, "#EXTINF:"); ok {
+			length, title, _ := strings.Cut(rest, ",")
+			next.Title = strings.TrimSpace(title)
+			// Attributes such as tvg-id may follow the length.
+			length, _, _ = strings.Cut(strings.TrimSpace(length), " ")
+			if secs, err := strconv.ParseFloat(length, 64); err == nil && secs > 0 {
+				next.Length = time.Duration(secs * float64(time.Second))
+			}
+			continue
+		}
 		// Skip comments and empty lines
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		// Check if it's a URL (starts with http:// or https://)
-		if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
-			return line, nil
+		next.URL = line
+		entries = append(entries, next)
+		next = PlaylistEntry{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, &PlaylistEmptyError{Format: "M3U"}
+	}
+
+	return entries, nil
+}
+
+// parseXSPF parses an XSPF playlist. A track with several locations yields
+// an entry for each of them.
+func parseXSPF(body io.Reader) ([]PlaylistEntry, error) {
+	var doc struct {
+		Tracks []struct {
+			Locations []string `xml:"location"`
+			Title     string   `xml:"title"`
+			Duration  int64    `xml:"duration"` // milliseconds
+		} `xml:"trackList>track"`
+	}
+	if err := xml.NewDecoder(body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse XSPF playlist: %w", err)
+	}
+
+	var entries []PlaylistEntry
+	for _, t := range doc.Tracks {
+		for _, loc := range t.Locations {
+			if loc = strings.TrimSpace(loc); loc == "" {
+				continue
+			}
+			entries = append(entries, PlaylistEntry{
+				URL:    loc,
+				Title:  strings.TrimSpace(t.Title),
+				Length: time.Duration(t.Duration) * time.Millisecond,
+			})
 		}
 	}
+	if len(entries) == 0 {
+		return nil, &PlaylistEmptyError{Format: "XSPF"}
+	}
 
-	return "", fmt.Errorf("no stream URL found in M3U playlist")
+	return entries, nil
 }
 
-// resolvePlaylistURL checks if the URL is a playlist file and resolves it to a stream URL
-func resolvePlaylistURL(url string) (string, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+// parseASX parses an ASX playlist. ASX element names are case-insensitive
+// and the files are often not well-formed XML, so the document is walked
+// token by token in non-strict mode. Both <ref> and <entryref> URLs are
+// returned; the latter point to further playlists.
+func parseASX(body io.Reader) ([]PlaylistEntry, error) {
+	d := xml.NewDecoder(body)
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	var entries []PlaylistEntry
+	var title string
+	inEntry, inTitle := false, false
+	first := 0 // index of the current entry's first ref
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A closing tag in another case than its opening one, most
+			// often </asx>, trips the decoder even in non-strict mode.
+			// Keep the entries read up to there.
+			if len(entries) > 0 {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse ASX playlist: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "entry":
+				inEntry, title, first = true, "", len(entries)
+			case "title":
+				inTitle = inEntry
+			case "ref", "entryref":
+				for _, a := range t.Attr {
+					if strings.EqualFold(a.Name.Local, "href") && strings.TrimSpace(a.Value) != "" {
+						entries = append(entries, PlaylistEntry{URL: strings.TrimSpace(a.Value), Title: title})
+					}
+				}
+			}
+		case xml.EndElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "entry":
+				// The title may come after the refs.
+				for i := first; i < len(entries); i++ {
+					if entries[i].Title == "" {
+						entries[i].Title = title
+					}
+				}
+				inEntry = false
+			case "title":
+				inTitle = false
+			}
+		case xml.CharData:
+			if inTitle {
+				title += strings.TrimSpace(string(t))
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return nil, &PlaylistEmptyError{Format: "ASX"}
 	}
 
-	req.Header.Add("accept", "*/*")
-	req.Header.Add("user-agent", "iTunes/12.9.2 (Macintosh; OS X 10.14.3) AppleWebKit/606.4.5")
+	return entries, nil
+}
 
-	dialer := &net.Dialer{Timeout: 5 * time.Second}
-	transport := &http.Transport{Dial: dialer.Dial}
-	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+// probeURL fetches rawURL to find out whether it is a stream, an HLS
+// playlist or a playlist of other URLs. Playlist entries are resolved
+// against the URL the playlist was finally served from.
+func probeURL(ctx context.Context, rawURL string, o *options) (*probeResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.playlistTimeout)
+	defer cancel()
 
-	resp, err := client.Do(req)
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch URL: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	o.setHeaders(req)
+
+	resp, err := o.httpClient().Do(req)
+	if err != nil {
+		if isICYResponse(err) {
+			// Legacy ICY servers aren't playlists; let Open handle them.
+			return &probeResult{kind: kindStream}, nil
+		}
+		return nil, fmt.Errorf("failed to fetch URL: %w", classifyError(rawURL, err))
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(rawURL, resp.StatusCode, resp.Status, resp.Header)
+	}
+
 	contentType := resp.Header.Get("Content-Type")
 
-	// Check if it's already a stream (has icy-metaint header)
-	if resp.Header.Get("icy-metaint") != "" {
-		// It's already a stream, return as-is
-		return url, nil
+	// Check if it's already a stream (has icy-metaint header or an audio
+	// content type that isn't a playlist)
+	if resp.Header.Get("icy-metaint") != "" || isStreamContentType(contentType) {
+		return &probeResult{kind: kindStream}, nil
 	}
 
 	// Read the body to check if it's a playlist
-	bodyData, err := io.ReadAll(resp.Body)
+	bodyData, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize+1))
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if len(bodyData) > maxPlaylistSize {
+		o.logger.Debug("response too long for a playlist, treating it as a stream", "url", rawURL, "content_type", contentType)
+		return &probeResult{kind: kindStream}, nil
 	}
 	content := string(bodyData)
 
-	// Check if it's a playlist file by content type or content
-	isPLS := strings.Contains(contentType, "audio/x-scpls") ||
-		strings.Contains(contentType, "application/pls+xml") ||
-		strings.HasSuffix(url, ".pls") ||
-		strings.Contains(content, "[playlist]") ||
-		strings.Contains(content, "File1=")
-
-	isM3U := strings.Contains(contentType, "audio/mpegurl") ||
-		strings.Contains(contentType, "application/vnd.apple.mpegurl") ||
-		strings.HasSuffix(url, ".m3u") ||
-		strings.HasSuffix(url, ".m3u8") ||
-		strings.Contains(content, "#EXTM3U") ||
-		(strings.HasPrefix(strings.TrimSpace(content), "http://") || strings.HasPrefix(strings.TrimSpace(content), "https://"))
-
-	if isPLS {
-		streamURL, err := parsePLS(strings.NewReader(content))
-		if err != nil {
-			return "", fmt.Errorf("failed to parse PLS playlist: %w", err)
+	if isHLSPlaylist(content) {
+		return &probeResult{kind: kindHLS}, nil
+	}
+
+	var entries []PlaylistEntry
+	format := playlistFormat(contentType, req.URL.Path, content)
+	switch format {
+	case "pls":
+		entries, err = parsePLS(strings.NewReader(content))
+	case "m3u":
+		entries, err = parseM3U(strings.NewReader(content))
+	case "xspf":
+		entries, err = parseXSPF(strings.NewReader(content))
+	case "asx":
+		entries, err = parseASX(strings.NewReader(content))
+	default:
+		return nil, &NotStreamError{URL: rawURL, ContentType: contentType}
+	}
+	var pe *PlaylistEmptyError
+	if errors.As(err, &pe) {
+		pe.URL = rawURL
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	base := resp.Request.URL
+	resolved := entries[:0]
+	for _, e := range entries {
+		u, err := base.Parse(e.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			o.logger.Debug("skipping unsupported playlist entry", "url", e.URL)
+			continue
 		}
-		return streamURL, nil
-	} else if isM3U {
-		streamURL, err := parseM3U(strings.NewReader(content))
+		e.URL = u.String()
+		resolved = append(resolved, e)
+	}
+	if len(resolved) == 0 {
+		return nil, &PlaylistEmptyError{URL: rawURL, Format: strings.ToUpper(format)}
+	}
+
+	return &probeResult{kind: kindPlaylist, entries: resolved}, nil
+}
+
+// playlistFormat identifies a playlist by its content type, file extension
+// or content. It returns "" if body doesn't look like a playlist.
+func playlistFormat(contentType, urlPath, content string) string {
+	ct := strings.ToLower(contentType)
+	ext := strings.ToLower(urlPath[strings.LastIndexByte(urlPath, '.')+1:])
+	head := strings.ToLower(strings.TrimSpace(content))
+	if len(head) > 512 {
+		head = head[:512]
+	}
+
+	switch {
+	case strings.Contains(ct, "audio/x-scpls") || strings.Contains(ct, "application/pls+xml") ||
+		ext == "pls" || strings.Contains(head, "[playlist]") || strings.Contains(content, "File1="):
+		return "pls"
+	case strings.Contains(ct, "xspf") || ext == "xspf" ||
+		(strings.Contains(head, "<playlist") && strings.Contains(head, "xspf.org")):
+		return "xspf"
+	case strings.Contains(ct, "x-ms-asf") || strings.Contains(ct, "x-ms-wax") || strings.Contains(ct, "x-ms-wvx") ||
+		ext == "asx" || ext == "wax" || ext == "wvx" || strings.HasPrefix(head, "<asx"):
+		return "asx"
+	case strings.Contains(ct, "mpegurl") || ext == "m3u" || ext == "m3u8" ||
+		strings.HasPrefix(head, "#extm3u") || strings.HasPrefix(head, "http://") || strings.HasPrefix(head, "https://"):
+		return "m3u"
+	}
+	return ""
+}
+
+// isStreamContentType reports whether contentType describes audio data rather
+// than a playlist.
+func isStreamContentType(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	if strings.Contains(ct, "mpegurl") || strings.Contains(ct, "scpls") || strings.Contains(ct, "x-ms-wax") {
+		return false
+	}
+	return strings.HasPrefix(ct, "audio/") || strings.HasPrefix(ct, "application/ogg")
+}
+
+// ResolvePlaylist returns every stream rawURL leads to. Playlists (PLS,
+// M3U, XSPF and ASX) are expanded in order, following playlists that point
+// to further playlists; a URL that is already a stream, including an HLS
+// playlist, is returned as the only entry. Entries that can't be reached
+// are still returned, as they may be mirrors that are only down for now.
+func ResolvePlaylist(ctx context.Context, rawURL string, opts ...Option) ([]PlaylistEntry, error) {
+	o := newOptions(opts...)
+
+	var entries []PlaylistEntry
+	err := walkPlaylist(ctx, rawURL, o, func(e PlaylistEntry, _ bool, _ error) error {
+		entries = append(entries, e)
+		return nil
+	})
+	o.closeIdleConnections()
+	if err != nil && len(entries) == 0 {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// errStopWalk stops walkPlaylist without an error.
+var errStopWalk = errors.New("stop walking playlist")
+
+// walkPlaylist calls fn with each stream rawURL leads to, depth first and
+// in playlist order, until fn returns errStopWalk. Playlist entries that
+// can't be fetched are passed to fn with the error, since whether they are
+// streams or playlists is unknown. The returned error joins the errors from
+// fn and everything else that went wrong along the way.
+func walkPlaylist(ctx context.Context, rawURL string, o *options, fn func(e PlaylistEntry, hls bool, probeErr error) error) error {
+	seen := make(map[string]bool)
+
+	var walk func(e PlaylistEntry, depth int) error
+	walk = func(e PlaylistEntry, depth int) error {
+		if seen[e.URL] {
+			return fmt.Errorf("%s: already visited", e.URL)
+		}
+		seen[e.URL] = true
+
+		res, err := probeURL(ctx, e.URL, o)
 		if err != nil {
-			return "", fmt.Errorf("failed to parse M3U playlist: %w", err)
+			if depth == 0 || ctx.Err() != nil {
+				return err
+			}
+			return fn(e, false, err)
+		}
+		switch res.kind {
+		case kindStream:
+			return fn(e, false, nil)
+		case kindHLS:
+			return fn(e, true, nil)
+		}
+
+		if depth >= maxPlaylistDepth {
+			return fmt.Errorf("%s: playlists nested more than %d deep", e.URL, maxPlaylistDepth)
+		}
+		o.logger.Debug("resolved playlist", "url", e.URL, "entries", len(res.entries))
+
+		var errs []error
+		for _, child := range res.entries {
+			err := walk(child, depth+1)
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, errStopWalk) || ctx.Err() != nil {
+				return err
+			}
+			errs = append(errs, err)
 		}
-		return streamURL, nil
+		return errors.Join(errs...)
 	}
 
-	return "", fmt.Errorf("URL does not appear to be a stream or playlist (Content-Type: %s)", contentType)
+	return walk(PlaylistEntry{URL: rawURL}, 0)
 }
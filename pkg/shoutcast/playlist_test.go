@@ -0,0 +1,217 @@
+package shoutcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePlaylist(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(io.Reader) ([]PlaylistEntry, error)
+		body  string
+		want  []PlaylistEntry
+	}{
+		{
+			name:  "pls",
+			parse: parsePLS,
+			body: "[playlist]\nNumberOfEntries=3\n" +
+				"File2=http://b.example.com/\nTitle2=Backup\nLength2=-1\n" +
+				"File1 = http://a.example.com/ \ntitle1=Main\nLength1=300\n" +
+				"Title3=No file\nFile10=http://c.example.com/\nVersion=2\n",
+			want: []PlaylistEntry{
+				{URL: "http://a.example.com/", Title: "Main", Length: 5 * time.Minute},
+				{URL: "http://b.example.com/", Title: "Backup"},
+				{URL: "http://c.example.com/"},
+			},
+		},
+		{
+			name:  "extended m3u",
+			parse: parseM3U,
+			body: "#EXTM3U\r\n#EXTINF:-1 tvg-id=\"x\",Radio, the station\r\nhttp://a.example.com/\r\n" +
+				"\r\n# comment\r\n#EXTINF:2.5,Jingle\r\njingle.mp3\r\nhttp://b.example.com/\r\n",
+			want: []PlaylistEntry{
+				{URL: "http://a.example.com/", Title: "Radio, the station"},
+				{URL: "jingle.mp3", Title: "Jingle", Length: 2500 * time.Millisecond},
+				{URL: "http://b.example.com/"},
+			},
+		},
+		{
+			name:  "xspf",
+			parse: parseXSPF,
+			body: `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <trackList>
+    <track>
+      <location>http://a.example.com/</location>
+      <location> http://b.example.com/ </location>
+      <title>Radio</title>
+      <duration>1500</duration>
+    </track>
+    <track><location></location></track>
+    <track><location>relative/stream</location></track>
+  </trackList>
+</playlist>`,
+			want: []PlaylistEntry{
+				{URL: "http://a.example.com/", Title: "Radio", Length: 1500 * time.Millisecond},
+				{URL: "http://b.example.com/", Title: "Radio", Length: 1500 * time.Millisecond},
+				{URL: "relative/stream"},
+			},
+		},
+		{
+			name:  "asx",
+			parse: parseASX,
+			body: `<ASX version="3.0">
+<Title>Playlist title</Title>
+<Entry>
+  <Ref HREF="http://a.example.com/" />
+  <ref href="mms://b.example.com/">
+  <TITLE>Radio &amp; more</TITLE>
+</Entry>
+<entry><ENTRYREF href="other.asx"/></entry>
+</asx>`,
+			want: []PlaylistEntry{
+				{URL: "http://a.example.com/", Title: "Radio & more"},
+				{URL: "mms://b.example.com/", Title: "Radio & more"},
+				{URL: "other.asx"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parse(strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("entries = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePlaylistEmpty(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(io.Reader) ([]PlaylistEntry, error)
+		body  string
+	}{
+		{"pls", parsePLS, "[playlist]\nTitle1=No file\nNumberOfEntries=1\n"},
+		{"m3u", parseM3U, "#EXTM3U\n#EXTINF:-1,Nothing\n"},
+		{"xspf", parseXSPF, `<playlist><trackList><track><title>x</title></track></trackList></playlist>`},
+		{"asx", parseASX, `<asx><entry><title>x</title></entry></asx>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.parse(strings.NewReader(tt.body))
+			var pe *PlaylistEmptyError
+			if !errors.As(err, &pe) {
+				t.Errorf("err = %v, want a PlaylistEmptyError", err)
+			}
+		})
+	}
+}
+
+// servePlaylists serves each path in files as a playlist with the given
+// body, and every other path as an MP3 stream.
+func servePlaylists(t *testing.T, files map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			w.Header().Set("Content-Type", "audio/mpeg")
+			w.Write(make([]byte, 1024))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResolvePlaylist(t *testing.T) {
+	srv := servePlaylists(t, map[string]string{
+		"/radio.pls": "[playlist]\nFile1=lists/main.m3u\nFile2=/backup.mp3\nFile3=ftp://example.com/x\n",
+		"/lists/main.m3u": "#EXTM3U\n#EXTINF:-1,Main\nhigh.mp3\n../low.mp3\n" +
+			"radio.xspf\n",
+		"/lists/radio.xspf": `<playlist xmlns="http://xspf.org/ns/0/"><trackList>` +
+			`<track><location>/lists/main.m3u</location></track>` +
+			`<track><location>live?format=aac</location></track></trackList></playlist>`,
+	})
+
+	entries, err := ResolvePlaylist(context.Background(), srv.URL+"/radio.pls")
+	if err != nil {
+		t.Fatalf("ResolvePlaylist: %v", err)
+	}
+
+	var urls []string
+	for _, e := range entries {
+		urls = append(urls, strings.TrimPrefix(e.URL, srv.URL))
+	}
+	want := []string{"/lists/high.mp3", "/low.mp3", "/lists/live?format=aac", "/backup.mp3"}
+	if !slices.Equal(urls, want) {
+		t.Errorf("URLs = %q, want %q", urls, want)
+	}
+	if entries[0].Title != "Main" {
+		t.Errorf("Title = %q, want %q", entries[0].Title, "Main")
+	}
+}
+
+func TestResolvePlaylistDepth(t *testing.T) {
+	// nested returns playlists /0.m3u to /<n-1>.m3u, each pointing to the
+	// next and the last one to a stream.
+	nested := func(n int) map[string]string {
+		files := make(map[string]string)
+		for i := range n {
+			files[fmt.Sprintf("/%d.m3u", i)] = fmt.Sprintf("#EXTM3U\n%d.m3u\n", i+1)
+		}
+		files[fmt.Sprintf("/%d.m3u", n-1)] = "#EXTM3U\nstream.mp3\n"
+		return files
+	}
+
+	srv := servePlaylists(t, nested(maxPlaylistDepth))
+	entries, err := ResolvePlaylist(context.Background(), srv.URL+"/0.m3u")
+	if err != nil || len(entries) != 1 || entries[0].URL != srv.URL+"/stream.mp3" {
+		t.Errorf("%d nested playlists: entries = %+v, err = %v, want the stream", maxPlaylistDepth, entries, err)
+	}
+
+	srv = servePlaylists(t, nested(maxPlaylistDepth+1))
+	entries, err = ResolvePlaylist(context.Background(), srv.URL+"/0.m3u")
+	if err == nil || !strings.Contains(err.Error(), "nested") {
+		t.Errorf("%d nested playlists: entries = %+v, err = %v, want a nesting error", maxPlaylistDepth+1, entries, err)
+	}
+}
+
+// TestResolvePlaylistLongBody checks that a body too long for a playlist is
+// taken for a stream without being read to the end.
+func TestResolvePlaylistLongBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		chunk := []byte(strings.Repeat("http://example.com/\n", 1024))
+		for r.Context().Err() == nil {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	entries, err := ResolvePlaylist(context.Background(), srv.URL+"/live", WithPlaylistTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("ResolvePlaylist: %v", err)
+	}
+	if len(entries) != 1 || entries[0].URL != srv.URL+"/live" {
+		t.Errorf("entries = %+v, want the URL itself", entries)
+	}
+}
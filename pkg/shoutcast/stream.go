@@ -1,18 +1,38 @@
 package shoutcast
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
-	"net"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // MetadataCallbackFunc is the type of the function called when the stream metadata changes
 type MetadataCallbackFunc func(m *Metadata)
 
+// MetadataEvent describes a metadata change and where in the audio it
+// happened.
+type MetadataEvent struct {
+	Metadata *Metadata
+
+	// Offset is the number of audio bytes Read had returned when the change
+	// happened. Audio from Offset onwards belongs to the new metadata.
+	Offset int64
+
+	// Time is the wall-clock time the metadata was received.
+	Time time.Time
+}
+
+// MetadataEventFunc is the type of the function called with a MetadataEvent
+// when the stream metadata changes
+type MetadataEventFunc func(e MetadataEvent)
+
 // Stream represents an open shoutcast stream.
 type Stream struct {
 	// The name of the server
@@ -30,9 +50,30 @@ type Stream struct {
 	// Bitrate of the server
 	Bitrate int
 
+	// Content-Type of the audio, such as audio/mpeg or audio/aac. Empty for
+	// HLS, where it depends on the segments.
+	ContentType string
+
+	// Whether the server lists the stream in its public directory (icy-pub)
+	Public bool
+
+	// Server software, from the Server header or SHOUTcast's icy-notice2
+	Server string
+
+	// Encoding parameters from ice-audio-info, icy-sr and friends
+	AudioInfo AudioInfo
+
+	// Every response header, as received
+	Header http.Header
+
 	// Optional function to be executed when stream metadata changes
 	MetadataCallbackFunc MetadataCallbackFunc
 
+	// Optional function to be executed with the audio offset when stream
+	// metadata changes. It runs inside Read, before any audio that belongs
+	// to the new metadata is returned.
+	MetadataEventFunc MetadataEventFunc
+
 	// Amount of bytes to read before expecting a metadata block
 	metaint int
 
@@ -42,212 +83,293 @@ type Stream struct {
 	// The number of bytes read since last metadata block
 	pos int
 
+	// The number of audio bytes returned by Read
+	offset int64
+
+	// Scratch space for metadata blocks, which are at most 255*16 bytes
+	metaBuf [255 * 16]byte
+
+	// The last metadata block received, used to skip parsing repeats
+	lastMetaBlock []byte
+
 	// The underlying data stream
 	rc io.ReadCloser
+
+	// Whether metadata arrives out of band, as with titled HLS segments
+	timedMetadata bool
+
+	// Decodes metadata and header text to UTF-8
+	decoder *textDecoder
+
+	// Context the stream was opened with; cancelling it aborts reads
+	ctx context.Context
+
+	logger *slog.Logger
 }
 
 // Open establishes a connection to a remote server.
-// It automatically handles playlist files (.pls, .m3u) and resolves them to stream URLs.
+// It automatically handles playlist files (.pls, .m3u, .xspf, .asx) and
+// resolves them to stream URLs.
 func Open(url string) (*Stream, error) {
-	log.Print("[INFO] Opening ", url)
+	return OpenContext(context.Background(), url)
+}
 
-	// Check if URL is a playlist and resolve it
-	resolvedURL, err := resolvePlaylistURL(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve playlist URL: %w", err)
+// OpenContext is like Open but the connection is bound to ctx. Cancelling
+// ctx aborts playlist resolution, the connect and any in-flight Read.
+//
+// When url is a playlist, its entries are tried in order until one
+// connects, so a playlist listing several mirrors survives some of them
+// being down.
+func OpenContext(ctx context.Context, url string, opts ...Option) (*Stream, error) {
+	o := newOptions(opts...)
+
+	o.logger.Info("opening stream", "url", url)
+
+	var stream *Stream
+	err := walkPlaylist(ctx, url, o, func(e PlaylistEntry, hls bool, err error) error {
+		if err != nil {
+			o.logger.Warn("playlist entry failed, trying next", "url", e.URL, "err", err)
+			return fmt.Errorf("%s: %w", e.URL, err)
+		}
+		if e.URL != url {
+			o.logger.Info("resolved playlist to stream URL", "url", e.URL, "title", e.Title)
+		}
+
+		if hls {
+			stream, err = openHLS(ctx, e.URL, o)
+		} else {
+			stream, err = openStream(ctx, e.URL, o)
+		}
+		if err != nil {
+			if e.URL != url {
+				o.logger.Warn("playlist entry failed, trying next", "url", e.URL, "err", err)
+			}
+			return fmt.Errorf("%s: %w", e.URL, err)
+		}
+		return errStopWalk
+	})
+	// The stream's own connection is in use, so this only closes what the
+	// playlist requests left open.
+	o.closeIdleConnections()
+	if stream != nil {
+		return stream, nil
 	}
-	if resolvedURL != url {
-		log.Print("[INFO] Resolved playlist to stream URL: ", resolvedURL)
-		url = resolvedURL
+	if err == nil {
+		err = errors.New("no stream found")
 	}
+	return nil, fmt.Errorf("failed to open stream: %w", err)
+}
 
-	req, err := http.NewRequest("GET", url, nil)
+// openStream connects to an ICY or plain HTTP audio stream.
+func openStream(ctx context.Context, url string, o *options) (*Stream, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	req.Header.Add("accept", "*/*")
-	req.Header.Add("user-agent", "iTunes/12.9.2 (Macintosh; OS X 10.14.3) AppleWebKit/606.4.5")
-	req.Header.Add("icy-metadata", "1")
-
-	// Timeout for establishing the connection.
-	// We don't want for the stream to timeout while we're reading it, but
-	// we do want a timeout for establishing the connection to the server.
-	dialer := &net.Dialer{Timeout: 5 * time.Second}
-	transport := &http.Transport{
-		Dial: dialer.Dial,
-		// Disable timeouts for streaming - we want to read indefinitely
-		ResponseHeaderTimeout: 10 * time.Second, // Only timeout on initial connection
-	}
-	// No timeout on the client - we want to stream indefinitely
-	client := &http.Client{Transport: transport}
-	resp, err := client.Do(req)
+	o.setHeaders(req)
+	req.Header.Set("icy-metadata", "1")
+
+	// No timeout on the client - we want to stream indefinitely. The request
+	// context bounds the lifetime of the connection instead.
+	resp, err := o.httpClient().Do(req)
 	if err != nil {
-		return nil, err
+		if !isICYResponse(err) {
+			return nil, classifyError(url, err)
+		}
+		// SHOUTcast v1 servers answer "ICY 200 OK", which net/http rejects.
+		o.logger.Debug("server did not answer with HTTP, retrying with ICY", "url", url)
+		header, body, err := openICY(ctx, url, o)
+		if err != nil {
+			return nil, err
+		}
+		return newStream(ctx, header, body, o)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, newStatusError(url, resp.StatusCode, resp.Status, resp.Header)
+	}
+
+	return newStream(ctx, resp.Header, resp.Body, o)
+}
+
+// newStream builds a Stream from the response headers and body of a
+// connected stream. body is closed if the headers can't be parsed.
+func newStream(ctx context.Context, header http.Header, body io.ReadCloser, o *options) (*Stream, error) {
+	var err error
+
+	for k, v := range header {
+		o.logger.Debug("stream header", "key", k, "value", v[0])
 	}
 
-	for k, v := range resp.Header {
-		log.Print("[DEBUG] HTTP header ", k, ": ", v[0])
+	decoder, err := o.textDecoder(header)
+	if err != nil {
+		body.Close()
+		return nil, err
 	}
 
+	// icy-br is sometimes "128,128" for the nominal and maximum rate.
 	var bitrate int
-	if rawBitrate := resp.Header.Get("icy-br"); rawBitrate != "" {
-		bitrate, err = strconv.Atoi(rawBitrate)
+	if rawBitrate, _, _ := strings.Cut(header.Get("icy-br"), ","); rawBitrate != "" {
+		bitrate, err = strconv.Atoi(strings.TrimSpace(rawBitrate))
 		if err != nil {
+			body.Close()
 			return nil, fmt.Errorf("cannot parse bitrate: %v", err)
 		}
 	}
+	info := audioInfoFromHeader(header)
+	if bitrate == 0 {
+		bitrate = info.Bitrate
+	}
 
-	metaint, err := strconv.Atoi(resp.Header.Get("icy-metaint"))
-	if err != nil {
-		return nil, fmt.Errorf("cannot parse metaint: %v", err)
+	// A missing or zero icy-metaint means the server sends no in-band
+	// metadata; the stream is then passed through unmodified.
+	var metaint int
+	if rawMetaint := header.Get("icy-metaint"); rawMetaint != "" {
+		metaint, err = strconv.Atoi(rawMetaint)
+		if err != nil {
+			body.Close()
+			return nil, fmt.Errorf("cannot parse metaint: %v", err)
+		}
 	}
 
 	s := &Stream{
-		Name:        resp.Header.Get("icy-name"),
-		Genre:       resp.Header.Get("icy-genre"),
-		Description: resp.Header.Get("icy-description"),
-		URL:         resp.Header.Get("icy-url"),
+		Name:        decoder.decode(header.Get("icy-name")),
+		Genre:       decoder.decode(header.Get("icy-genre")),
+		Description: decoder.decode(header.Get("icy-description")),
+		URL:         decoder.decode(header.Get("icy-url")),
 		Bitrate:     bitrate,
+		ContentType: header.Get("Content-Type"),
+		Public:      header.Get("icy-pub") == "1",
+		Server:      serverName(header),
+		AudioInfo:   info,
+		Header:      header.Clone(),
 		metaint:     metaint,
 		metadata:    nil,
 		pos:         0,
-		rc:          resp.Body,
+		rc:          body,
+		ctx:         ctx,
+		decoder:     decoder,
+		logger:      o.logger,
 	}
 
 	return s, nil
 }
 
-// Read implements the standard Read interface
-func (s *Stream) Read(buf []byte) (dataLen int, err error) {
-	// We need to read and process data in a way that handles metadata blocks
-	// that may span across multiple Read calls. We'll use a simpler approach:
-	// read audio data in chunks of metaint bytes, then skip metadata.
-
-	cleanBuf := make([]byte, 0, len(buf))
-
-	for len(cleanBuf) < len(buf) {
-		// Calculate how many audio bytes we need
-		bytesNeeded := len(buf) - len(cleanBuf)
-		bytesUntilMetadata := s.metaint - s.pos
-
-		if bytesUntilMetadata == 0 {
-			// We're at a metadata boundary, extract and skip it
-			// Read the metadata length byte
-			var metaLenByte [1]byte
-			var n int
-			n, err = s.rc.Read(metaLenByte[:])
-			if err != nil && err != io.EOF {
-				break
-			}
-			if n == 0 {
-				if err == nil {
-					err = io.EOF
-				}
-				break
-			}
+// serverName identifies the server software. SHOUTcast v1 has no Server
+// header and names itself in icy-notice2 instead, with an HTML line break.
+func serverName(header http.Header) string {
+	if s := header.Get("Server"); s != "" {
+		return s
+	}
+	s := header.Get("icy-notice2")
+	s, _, _ = strings.Cut(s, "<BR>")
+	return strings.TrimSpace(s)
+}
+
+// Read implements the standard Read interface. Audio is read directly into
+// buf; the position relative to the next metadata block is kept across calls,
+// so a Read never spans a metadata boundary and never allocates for audio.
+func (s *Stream) Read(buf []byte) (int, error) {
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if s.metaint <= 0 {
+		n, err := s.rc.Read(buf)
+		s.offset += int64(n)
+		return n, err
+	}
+
+	if len(buf) == 0 {
+		return 0, nil
+	}
 
-			metaBlockLen := int(metaLenByte[0]) * 16
-			if metaBlockLen > 0 {
-				// Read and parse the metadata block
-				metaBuf := make([]byte, metaBlockLen)
-				n = 0
-				for n < metaBlockLen && err == nil {
-					var nn int
-					nn, err = s.rc.Read(metaBuf[n:])
-					n += nn
-				}
-				if n == metaBlockLen {
-					// Parse and process metadata
-					if m := NewMetadata(metaBuf); !m.Equals(s.metadata) {
-						s.metadata = m
-						if s.MetadataCallbackFunc != nil {
-							s.MetadataCallbackFunc(s.metadata)
-						}
-					}
-				} else if err == nil || err == io.EOF {
-					err = io.ErrUnexpectedEOF
-				}
+	for {
+		if s.pos < s.metaint {
+			n, err := s.rc.Read(buf[:min(len(buf), s.metaint-s.pos)])
+			s.pos += n
+			s.offset += int64(n)
+			if n > 0 || err != nil {
+				return n, err
 			}
-			// Empty metadata block (length byte was 0), nothing more to read
-			s.pos = 0
 			continue
 		}
 
-		// Read audio data up to the next metadata block or until we have enough
-		bytesToRead := bytesUntilMetadata
-		if bytesToRead > bytesNeeded {
-			bytesToRead = bytesNeeded
+		// We're at a metadata boundary, extract and skip it
+		if err := s.readMetadata(); err != nil {
+			return 0, err
 		}
+		s.pos = 0
+	}
+}
 
-		// Read directly into cleanBuf
-		startLen := len(cleanBuf)
-		cleanBuf = append(cleanBuf, make([]byte, bytesToRead)...)
-		n, readErr := s.rc.Read(cleanBuf[startLen:])
-		if n == 0 {
-			if readErr != nil && readErr != io.EOF {
-				err = readErr
-			} else if err == nil {
-				err = io.EOF
-			}
-			cleanBuf = cleanBuf[:startLen]
-			break
-		}
-		cleanBuf = cleanBuf[:startLen+n]
-		s.pos += n
+// readMetadata reads the metadata block at the current position: a length
+// byte giving the block size in 16 byte units, followed by the block. An
+// empty block means the metadata didn't change.
+func (s *Stream) readMetadata() error {
+	if _, err := io.ReadFull(s.rc, s.metaBuf[:1]); err != nil {
+		return err
+	}
 
-		if readErr != nil && readErr != io.EOF {
-			err = readErr
-			break
-		}
+	metaBlockLen := int(s.metaBuf[0]) * 16
+	if metaBlockLen == 0 {
+		return nil
+	}
 
-		// If we've read metaint bytes, we're at a metadata boundary - read and skip the metadata block
-		if s.pos >= s.metaint {
-			s.pos = 0
-			// Read the metadata length byte
-			var metaLenByte [1]byte
-			var mn int
-			mn, err = s.rc.Read(metaLenByte[:])
-			if err != nil && err != io.EOF {
-				break
-			}
-			if mn == 0 {
-				if err == nil {
-					err = io.EOF
-				}
-				break
-			}
-			metaBlockLen := int(metaLenByte[0]) * 16
-			if metaBlockLen > 0 {
-				metaBuf := make([]byte, metaBlockLen)
-				mn = 0
-				for mn < metaBlockLen && err == nil {
-					var nn int
-					nn, err = s.rc.Read(metaBuf[mn:])
-					mn += nn
-				}
-				if mn == metaBlockLen && s.MetadataCallbackFunc != nil {
-					if m := NewMetadata(metaBuf); !m.Equals(s.metadata) {
-						s.metadata = m
-						s.MetadataCallbackFunc(s.metadata)
-					}
-				} else if mn < metaBlockLen && (err == nil || err == io.EOF) {
-					err = io.ErrUnexpectedEOF
-				}
-			}
+	if _, err := io.ReadFull(s.rc, s.metaBuf[:metaBlockLen]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
 		}
+		return err
 	}
 
-	// Copy the clean buffer to the output buffer
-	dataLen = len(cleanBuf)
-	if dataLen > 0 {
-		copy(buf, cleanBuf)
+	// Many servers repeat the same block every interval; only parse it when
+	// it changed.
+	block := s.metaBuf[:metaBlockLen]
+	if bytes.Equal(block, s.lastMetaBlock) {
+		return nil
 	}
+	s.lastMetaBlock = append(s.lastMetaBlock[:0], block...)
+
+	s.updateMetadata(parseMetadata(block, s.decoder))
+	return nil
+}
+
+// updateMetadata records m and calls the metadata callbacks if it differs
+// from the current metadata.
+func (s *Stream) updateMetadata(m *Metadata) {
+	if m.Equals(s.metadata) {
+		return
+	}
+	s.metadata = m
+	if s.MetadataEventFunc != nil {
+		s.MetadataEventFunc(MetadataEvent{
+			Metadata: m,
+			Offset:   s.offset,
+			Time:     time.Now(),
+		})
+	}
+	if s.MetadataCallbackFunc != nil {
+		s.MetadataCallbackFunc(s.metadata)
+	}
+}
+
+// Offset returns the number of audio bytes returned by Read so far.
+func (s *Stream) Offset() int64 {
+	return s.offset
+}
 
-	return dataLen, err
+// HasMetadata reports whether the stream carries metadata, either in-band
+// ICY metadata or HLS segment titles, starting with the first segment.
+// Without it the stream is read in passthrough mode and MetadataCallbackFunc
+// is never called.
+func (s *Stream) HasMetadata() bool {
+	return s.metaint > 0 || s.timedMetadata
 }
 
 // Close closes the stream
 func (s *Stream) Close() error {
-	log.Print("[INFO] Closing ", s.URL)
+	s.logger.Info("closing stream", "url", s.URL)
 	return s.rc.Close()
 }
@@ -0,0 +1,310 @@
+package shoutcast
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// benchmarkStreamMB is the audio read per benchmark iteration.
+const benchmarkStreamMB = 1 << 20
+
+// icyData returns about benchmarkStreamMB of audio with a metadata block
+// every metaint bytes. The title changes once, so each pass parses two
+// blocks and skips the repeats.
+func icyData(metaint int) []byte {
+	blockA := metadataBlock("StreamTitle='Artist - First';")
+	blockB := metadataBlock("StreamTitle='Artist - Second';")
+
+	var b bytes.Buffer
+	audio := bytes.Repeat([]byte{0xAA}, metaint)
+	for i := 0; i < benchmarkStreamMB/metaint; i++ {
+		b.Write(audio)
+		if i == 0 {
+			b.Write(blockA)
+		} else {
+			b.Write(blockB)
+		}
+	}
+	return b.Bytes()
+}
+
+// metadataBlock returns s as a length-prefixed metadata block.
+func metadataBlock(s string) []byte {
+	n := (len(s) + 15) / 16
+	b := make([]byte, 1+n*16)
+	b[0] = byte(n)
+	copy(b[1:], s)
+	return b
+}
+
+func BenchmarkStreamRead(b *testing.B) {
+	benchmarks := []struct {
+		name    string
+		metaint int
+		data    []byte
+	}{
+		{name: "metaint", metaint: 16000, data: icyData(16000)},
+		{name: "passthrough", data: bytes.Repeat([]byte{0xAA}, benchmarkStreamMB)},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			r := bytes.NewReader(bm.data)
+			s := newTestStream(r, bm.metaint)
+			buf := make([]byte, 32*1024)
+
+			b.ReportAllocs()
+			for b.Loop() {
+				r.Reset(bm.data)
+				s.pos, s.offset = 0, 0
+				for {
+					if _, err := s.Read(buf); err == io.EOF {
+						break
+					} else if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.SetBytes(s.offset)
+		})
+	}
+}
+
+// newTestStream returns a Stream reading ICY data from r.
+func newTestStream(r io.Reader, metaint int) *Stream {
+	return &Stream{
+		metaint: metaint,
+		rc:      io.NopCloser(r),
+		decoder: defaultTextDecoder,
+		ctx:     context.Background(),
+		logger:  slog.New(slog.DiscardHandler),
+	}
+}
+
+// icyStream interleaves audio with a metadata block after every metaint
+// bytes of it. The i-th block carries titles[i]; an empty or missing title
+// gives an empty block.
+func icyStream(audio []byte, metaint int, titles []string) []byte {
+	var b bytes.Buffer
+	for i := 0; len(audio) >= metaint; i++ {
+		b.Write(audio[:metaint])
+		audio = audio[metaint:]
+		if i < len(titles) && titles[i] != "" {
+			b.Write(metadataBlock("StreamTitle='" + titles[i] + "';"))
+		} else {
+			b.WriteByte(0)
+		}
+	}
+	b.Write(audio)
+	return b.Bytes()
+}
+
+// chunkReader returns at most n bytes per Read.
+type chunkReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	return c.r.Read(p[:min(len(p), c.n)])
+}
+
+// readAll reads s to the end with Reads of size bytes.
+func readAll(s *Stream, size int) ([]byte, error) {
+	var out []byte
+	buf := make([]byte, size)
+	for {
+		n, err := s.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+}
+
+func TestStreamRead(t *testing.T) {
+	audio := make([]byte, 1000)
+	for i := range audio {
+		audio[i] = byte(i % 251)
+	}
+
+	tests := []struct {
+		name    string
+		metaint int
+		data    []byte
+	}{
+		{
+			name:    "metadata blocks",
+			metaint: 64,
+			data:    icyStream(audio, 64, []string{"First", "First", "", "Second"}),
+		},
+		{
+			name:    "metadata after every byte",
+			metaint: 1,
+			data:    icyStream(audio, 1, []string{"First", "", "Second"}),
+		},
+		{
+			name:    "audio ends on a boundary",
+			metaint: 100,
+			data:    icyStream(audio, 100, []string{"First"}),
+		},
+		{
+			name: "passthrough",
+			data: audio,
+		},
+		{
+			name: "passthrough of what looks like metadata",
+			data: icyStream(audio, 64, []string{"First"}),
+		},
+	}
+
+	for _, tt := range tests {
+		want := audio
+		if tt.metaint == 0 {
+			want = tt.data
+		}
+		for _, chunk := range []int{1, 5, 1 << 20} {
+			for _, size := range []int{1, 3, 7, 64, 4096} {
+				t.Run(fmt.Sprintf("%s/chunk %d/read %d", tt.name, chunk, size), func(t *testing.T) {
+					s := newTestStream(&chunkReader{r: bytes.NewReader(tt.data), n: chunk}, tt.metaint)
+					got, err := readAll(s, size)
+					if err != nil {
+						t.Fatalf("Read: %v", err)
+					}
+					if !bytes.Equal(got, want) {
+						t.Errorf("read %d bytes of audio that differ from the %d sent", len(got), len(want))
+					}
+					if s.Offset() != int64(len(want)) {
+						t.Errorf("Offset() = %d, want %d", s.Offset(), len(want))
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestStreamReadTruncated(t *testing.T) {
+	audio := bytes.Repeat([]byte{0xAA}, 32)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"block cut short", append(audio[:16:16], 2, 'S', 't'), io.ErrUnexpectedEOF},
+		{"length byte only", append(audio[:16:16], 1), io.ErrUnexpectedEOF},
+		{"ends before the length byte", audio[:16], io.EOF},
+		{"ends mid-interval", icyStream(audio[:24], 16, nil), io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStream(bytes.NewReader(tt.data), 16)
+			got, err := readAll(s, 7)
+			if tt.want == io.EOF {
+				if err != nil {
+					t.Errorf("Read: %v, want io.EOF", err)
+				}
+			} else if !errors.Is(err, tt.want) {
+				t.Errorf("Read: %v, want %v", err, tt.want)
+			}
+			if len(got) == 0 || !bytes.Equal(got, audio[:len(got)]) {
+				t.Errorf("read % X before the end", got)
+			}
+		})
+	}
+}
+
+func TestStreamReadCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newTestStream(bytes.NewReader(make([]byte, 100)), 0)
+	s.ctx = ctx
+	cancel()
+	if n, err := s.Read(make([]byte, 10)); n != 0 || !errors.Is(err, context.Canceled) {
+		t.Errorf("Read() = %d, %v, want 0, context.Canceled", n, err)
+	}
+}
+
+// TestStreamMetadataOffsets checks that each title change is reported at
+// the offset of the first audio byte after its metadata block, before that
+// byte is returned by Read.
+func TestStreamMetadataOffsets(t *testing.T) {
+	audio := make([]byte, 1000)
+	for i := range audio {
+		audio[i] = byte(i % 251)
+	}
+	data := icyStream(audio, 64, []string{"First", "First", "", "Second", "Second", "Third"})
+
+	wantTitles := []string{"First", "Second", "Third"}
+	wantOffsets := []int64{64, 256, 384}
+
+	for _, chunk := range []int{1, 5, 1 << 20} {
+		for _, size := range []int{1, 7, 64, 4096} {
+			t.Run(fmt.Sprintf("chunk %d/read %d", chunk, size), func(t *testing.T) {
+				s := newTestStream(&chunkReader{r: bytes.NewReader(data), n: chunk}, 64)
+
+				var read int64
+				var titles []string
+				var offsets []int64
+				s.MetadataEventFunc = func(e MetadataEvent) {
+					if e.Offset != read {
+						t.Errorf("%q reported at offset %d after %d bytes were read", e.Metadata.StreamTitle, e.Offset, read)
+					}
+					titles = append(titles, e.Metadata.StreamTitle)
+					offsets = append(offsets, e.Offset)
+				}
+
+				buf := make([]byte, size)
+				for {
+					n, err := s.Read(buf)
+					read += int64(n)
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatalf("Read: %v", err)
+					}
+				}
+
+				if !slices.Equal(titles, wantTitles) || !slices.Equal(offsets, wantOffsets) {
+					t.Errorf("titles %q at %d, want %q at %d", titles, offsets, wantTitles, wantOffsets)
+				}
+			})
+		}
+	}
+}
+
+func TestServerName(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   string
+	}{
+		{"server header", map[string]string{"Server": "Icecast 2.4.4", "icy-notice2": "SHOUTcast<BR>"}, "Icecast 2.4.4"},
+		{"shoutcast v1", map[string]string{"icy-notice2": "SHOUTcast Distributed Network Audio Server/Linux v1.9.8<BR>"}, "SHOUTcast Distributed Network Audio Server/Linux v1.9.8"},
+		{"notice without a break", map[string]string{"icy-notice2": " Shoutcast Server "}, "Shoutcast Server"},
+		{"none", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := make(http.Header)
+			for k, v := range tt.header {
+				h.Set(k, v)
+			}
+			if got := serverName(h); got != tt.want {
+				t.Errorf("serverName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
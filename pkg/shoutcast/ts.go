@@ -0,0 +1,168 @@
+package shoutcast
+
+import (
+	"errors"
+
+	"github.com/zachfi/streamgo/pkg/id3"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+
+	// Elementary stream types carried in HLS audio segments.
+	tsStreamMPEG1Audio = 0x03
+	tsStreamMPEG2Audio = 0x04
+	tsStreamADTS       = 0x0F
+	tsStreamID3        = 0x15
+)
+
+// isMPEGTS reports whether data looks like an MPEG transport stream.
+func isMPEGTS(data []byte) bool {
+	return len(data) >= tsPacketSize && data[0] == tsSyncByte &&
+		(len(data) < 2*tsPacketSize || data[tsPacketSize] == tsSyncByte)
+}
+
+// demuxTS extracts the audio elementary stream and the ID3 timed metadata
+// from an MPEG-TS segment. The PAT and PMT are expected to fit in a single
+// packet, which is the case for every HLS packager we've seen.
+func demuxTS(data []byte) ([]byte, []*id3.Tag, error) {
+	pmtPID, audioPID, id3PID := -1, -1, -1
+
+	var audio []byte
+	var meta []byte
+	var tags []*id3.Tag
+
+	flushMeta := func() {
+		if len(meta) == 0 {
+			return
+		}
+		if tag, _, ok := id3.Parse(meta); ok {
+			tags = append(tags, tag)
+		}
+		meta = meta[:0]
+	}
+
+	for off := 0; off+tsPacketSize <= len(data); off += tsPacketSize {
+		pkt := data[off : off+tsPacketSize]
+		if pkt[0] != tsSyncByte {
+			return nil, nil, errors.New("lost MPEG-TS sync")
+		}
+
+		start := pkt[1]&0x40 != 0
+		pid := int(pkt[1]&0x1F)<<8 | int(pkt[2])
+		afc := (pkt[3] >> 4) & 0x03
+
+		payload := pkt[4:]
+		if afc&0x02 != 0 {
+			if len(payload) == 0 || int(payload[0])+1 > len(payload) {
+				continue
+			}
+			payload = payload[int(payload[0])+1:]
+		}
+		if afc&0x01 == 0 || len(payload) == 0 {
+			continue
+		}
+
+		switch {
+		case pid == 0 && start:
+			if p, ok := parsePAT(payload); ok {
+				pmtPID = p
+			}
+		case pid == pmtPID && start:
+			audioPID, id3PID = parsePMT(payload)
+		case pid == audioPID:
+			if start {
+				payload = stripPESHeader(payload)
+			}
+			audio = append(audio, payload...)
+		case pid == id3PID:
+			if start {
+				flushMeta()
+				payload = stripPESHeader(payload)
+			}
+			meta = append(meta, payload...)
+		}
+	}
+	flushMeta()
+
+	if audioPID < 0 {
+		return nil, nil, errors.New("no supported audio stream in MPEG-TS segment")
+	}
+
+	return audio, tags, nil
+}
+
+// psiSection returns the section following the pointer field of a PSI
+// payload, bounded by its section length.
+func psiSection(payload []byte) ([]byte, bool) {
+	ptr := int(payload[0])
+	if 1+ptr+3 > len(payload) {
+		return nil, false
+	}
+	sec := payload[1+ptr:]
+	length := int(sec[1]&0x0F)<<8 | int(sec[2])
+	if 3+length > len(sec) || length < 9 {
+		return nil, false
+	}
+	// Drop the header and the trailing CRC.
+	return sec[3 : 3+length-4], true
+}
+
+// parsePAT returns the PMT PID of the first program.
+func parsePAT(payload []byte) (int, bool) {
+	sec, ok := psiSection(payload)
+	if !ok {
+		return 0, false
+	}
+	for i := 5; i+4 <= len(sec); i += 4 {
+		program := int(sec[i])<<8 | int(sec[i+1])
+		if program == 0 {
+			continue // network PID
+		}
+		return int(sec[i+2]&0x1F)<<8 | int(sec[i+3]), true
+	}
+	return 0, false
+}
+
+// parsePMT returns the PIDs of the first audio and ID3 metadata streams, or
+// -1 when there is none.
+func parsePMT(payload []byte) (audioPID, id3PID int) {
+	audioPID, id3PID = -1, -1
+
+	sec, ok := psiSection(payload)
+	if !ok || len(sec) < 9 {
+		return
+	}
+	infoLen := int(sec[7]&0x0F)<<8 | int(sec[8])
+	for i := 9 + infoLen; i+5 <= len(sec); {
+		streamType := sec[i]
+		pid := int(sec[i+1]&0x1F)<<8 | int(sec[i+2])
+		esLen := int(sec[i+3]&0x0F)<<8 | int(sec[i+4])
+		switch streamType {
+		case tsStreamMPEG1Audio, tsStreamMPEG2Audio, tsStreamADTS:
+			if audioPID < 0 {
+				audioPID = pid
+			}
+		case tsStreamID3:
+			if id3PID < 0 {
+				id3PID = pid
+			}
+		}
+		i += 5 + esLen
+	}
+	return
+}
+
+// stripPESHeader returns the payload following the PES header at the start
+// of b.
+func stripPESHeader(b []byte) []byte {
+	if len(b) < 9 || b[0] != 0 || b[1] != 0 || b[2] != 1 {
+		return b
+	}
+	n := 9 + int(b[8])
+	if n > len(b) {
+		return nil
+	}
+	return b[n:]
+}